@@ -0,0 +1,138 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/simomu-github/sfflt_lang/compiler"
+)
+
+// Assembler converts mnemonic assembly such as `push 5`, `label loop` and
+// `jz loop` into instructions. Instructions are separated by new lines or
+// semicolons, and `//` starts a comment. Labels are named, and numbered in
+// the order they appear.
+type Assembler struct {
+	filename string
+	source   string
+	labels   map[string]int
+	marked   map[string]bool
+	// uses records where each label first appears, and order the labels in
+	// the order they appear, to report the labels which are never marked.
+	uses   map[string]compiler.SourcePos
+	order  []string
+	Errors []string
+}
+
+func New(filename string, source string) *Assembler {
+	return &Assembler{
+		filename: filename,
+		source:   source,
+		labels:   map[string]int{},
+		marked:   map[string]bool{},
+		uses:     map[string]compiler.SourcePos{},
+		Errors:   []string{},
+	}
+}
+
+func (a *Assembler) Assemble() []compiler.Instruction {
+	instructions := []compiler.Instruction{}
+	for i, line := range strings.Split(a.source, "\n") {
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+
+		column := 0
+		for _, statement := range strings.Split(line, ";") {
+			fields := strings.Fields(statement)
+			if len(fields) != 0 {
+				pos := compiler.SourcePos{
+					Filename: a.filename,
+					Line:     i + 1,
+					Column:   column + strings.Index(statement, fields[0]) + 1,
+				}
+				if instruction, ok := a.assemble(fields, pos); ok {
+					instructions = append(instructions, instruction)
+				}
+			}
+			column += len(statement) + 1
+		}
+	}
+
+	for _, name := range a.order {
+		if !a.marked[name] {
+			a.assembleError(a.uses[name], name, "Undefined label.")
+		}
+	}
+
+	return instructions
+}
+
+func (a *Assembler) HadErrors() bool {
+	return len(a.Errors) != 0
+}
+
+func (a *Assembler) assemble(fields []string, pos compiler.SourcePos) (compiler.Instruction, bool) {
+	op, ok := compiler.LookupMnemonic(fields[0])
+	if !ok {
+		a.assembleError(pos, fields[0], "Unknown mnemonic.")
+		return compiler.Instruction{}, false
+	}
+
+	instruction := compiler.Instruction{Op: op, SourcePos: pos}
+	if !op.HasArg() && !op.HasLabel() {
+		if len(fields) > 1 {
+			a.assembleError(pos, fields[1], "Unexpected operand.")
+			return instruction, false
+		}
+		return instruction, true
+	}
+
+	if len(fields) == 1 {
+		a.assembleError(pos, fields[0], "Expect operand.")
+		return instruction, false
+	}
+	if len(fields) > 2 {
+		a.assembleError(pos, fields[2], "Unexpected operand.")
+		return instruction, false
+	}
+
+	if op.HasArg() {
+		value, err := strconv.ParseInt(fields[1], 0, 64)
+		if err != nil {
+			a.assembleError(pos, fields[1], "Invalid number.")
+			return instruction, false
+		}
+		instruction.Arg = value
+		return instruction, true
+	}
+
+	if op == compiler.LABEL {
+		if a.marked[fields[1]] {
+			a.assembleError(pos, fields[1], "Label is already marked.")
+			return instruction, false
+		}
+		a.marked[fields[1]] = true
+	}
+	instruction.Label = a.label(fields[1], pos)
+	return instruction, true
+}
+
+// label returns the number of the label named name.
+func (a *Assembler) label(name string, pos compiler.SourcePos) int {
+	if label, ok := a.labels[name]; ok {
+		return label
+	}
+
+	a.labels[name] = len(a.labels)
+	a.uses[name] = pos
+	a.order = append(a.order, name)
+	return a.labels[name]
+}
+
+func (a *Assembler) assembleError(pos compiler.SourcePos, literal string, message string) {
+	a.Errors = append(
+		a.Errors,
+		fmt.Sprintf("%s:%d Error at '%s': %s\n", pos.Filename, pos.Line, literal, message),
+	)
+}
@@ -0,0 +1,100 @@
+package asm
+
+import (
+	"testing"
+
+	"github.com/simomu-github/sfflt_lang/compiler"
+)
+
+func TestAssemble(t *testing.T) {
+	input := `// countdown
+push 3
+label loop // loop head
+  dup; putn
+  push -1; add
+  dup; jz end; jump loop
+label end
+  call f; end
+label f
+  ret
+`
+	expects := []string{
+		"FFFLLT", // push 3
+		"TFFFT",  // mark label loop
+		"FTF",    // dup
+		"LTFL",   // putn
+		"FFLLT",  // push -1
+		"LFFF",   // add
+		"FTF",    // dup
+		"TLFLT",  // jump end when zero
+		"TFTFT",  // jump loop
+		"TFFLT",  // mark label end
+		"TFLLFT", // call f
+		"TTT",    // end
+		"TFFLFT", // mark label f
+		"TLT",    // end sub
+	}
+
+	assembler := New("script", input)
+	instructions := assembler.Assemble()
+	if assembler.HadErrors() {
+		t.Fatalf("Assemble error occurred. %v", assembler.Errors)
+	}
+
+	actuals := compiler.Encode(instructions)
+	if len(actuals) != len(expects) {
+		t.Fatalf("instruction length wrong. expected=%q, got=%q", expects, actuals)
+	}
+	for i, expect := range expects {
+		if actuals[i] != expect {
+			t.Fatalf("tests[%d] - instruction wrong. expected=%q, got=%q", i, expect, actuals[i])
+		}
+	}
+}
+
+func TestAssembleSourcePos(t *testing.T) {
+	input := "push 1\n  dup;  add"
+	assembler := New("script", input)
+	instructions := assembler.Assemble()
+
+	expects := []compiler.SourcePos{
+		{Filename: "script", Line: 1, Column: 1},
+		{Filename: "script", Line: 2, Column: 3},
+		{Filename: "script", Line: 2, Column: 9},
+	}
+	for i, expect := range expects {
+		if instructions[i].SourcePos != expect {
+			t.Fatalf("tests[%d] - source position wrong. expected=%+v, got=%+v", i, expect, instructions[i].SourcePos)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	input := `push
+pop
+push x
+dup 1
+label a
+label a
+jump b
+`
+	expects := []string{
+		"script:1 Error at 'push': Expect operand.\n",
+		"script:2 Error at 'pop': Unknown mnemonic.\n",
+		"script:3 Error at 'x': Invalid number.\n",
+		"script:4 Error at '1': Unexpected operand.\n",
+		"script:6 Error at 'a': Label is already marked.\n",
+		"script:7 Error at 'b': Undefined label.\n",
+	}
+
+	assembler := New("script", input)
+	assembler.Assemble()
+	if len(assembler.Errors) != len(expects) {
+		t.Fatalf("Assemble errors count does not match. %v", assembler.Errors)
+	}
+	for i, expect := range expects {
+		if assembler.Errors[i] != expect {
+			t.Fatalf("tests[%d] - error wrong. expected=%q, got=%q", i, expect, assembler.Errors[i])
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/simomu-github/sfflt_lang/compiler"
+)
+
+// Disassembler decodes FFLT back into instructions. Characters other than
+// F, L and T are skipped, so formatted output such as the square format can
+// be decoded as it is.
+type Disassembler struct {
+	filename string
+	source   string
+	// code is the source without the skipped characters, and offsets the
+	// byte offset in the source of each character of code.
+	code    string
+	offsets []int
+	labels  map[string]int
+	// Labels are the bits of each label, indexed by the Label of the
+	// instructions. Labels are compared as bits rather than as numbers, so
+	// `FL`, `L` and the empty label are all different labels.
+	Labels []string
+	Errors []string
+}
+
+func NewDisassembler(filename string, source string) *Disassembler {
+	code := []byte{}
+	offsets := []int{}
+	for i := 0; i < len(source); i++ {
+		switch source[i] {
+		case 'F', 'L', 'T':
+			code = append(code, source[i])
+			offsets = append(offsets, i)
+		}
+	}
+
+	return &Disassembler{
+		filename: filename,
+		source:   source,
+		code:     string(code),
+		offsets:  offsets,
+		labels:   map[string]int{},
+		Labels:   []string{},
+		Errors:   []string{},
+	}
+}
+
+// Disassemble decodes the instructions until the end of the source. Decoding
+// stops at the first malformed instruction, since the instructions after it
+// can not be told apart.
+func (d *Disassembler) Disassemble() []compiler.Instruction {
+	instructions := []compiler.Instruction{}
+	for start := 0; start < len(d.code); {
+		instruction, next, ok := d.decode(start)
+		if !ok {
+			break
+		}
+		instructions = append(instructions, instruction)
+		start = next
+	}
+
+	return instructions
+}
+
+func (d *Disassembler) HadErrors() bool {
+	return len(d.Errors) != 0
+}
+
+// decode decodes the instruction at start of code, and returns it with the
+// start of the next instruction.
+func (d *Disassembler) decode(start int) (compiler.Instruction, int, bool) {
+	op, ok := d.decodeOp(start)
+	if !ok {
+		return compiler.Instruction{}, 0, false
+	}
+
+	instruction := compiler.Instruction{Op: op, SourcePos: d.sourcePos(start)}
+	next := start + len(op)
+	if !op.HasArg() && !op.HasLabel() {
+		return instruction, next, true
+	}
+
+	if op.HasArg() {
+		if next == len(d.code) {
+			d.disassembleError(start, "Unterminated number.")
+			return instruction, 0, false
+		}
+		if d.code[next] == 'T' {
+			d.disassembleError(next, "Expect sign of number.")
+			return instruction, 0, false
+		}
+		next++
+	}
+
+	end := strings.IndexByte(d.code[next:], 'T')
+	if end < 0 {
+		if op.HasArg() {
+			d.disassembleError(start, "Unterminated number.")
+		} else {
+			d.disassembleError(start, "Unterminated label.")
+		}
+		return instruction, 0, false
+	}
+
+	param := d.code[start+len(op) : next+end]
+	if op.HasArg() {
+		if end > 63 {
+			d.disassembleError(next, "Number is too large.")
+			return instruction, 0, false
+		}
+		instruction.Arg = compiler.DecodeNumber(param)
+	} else {
+		instruction.Label = d.label(param)
+	}
+	return instruction, next + end + 1, true
+}
+
+// label returns the number of the label whose bits are param.
+func (d *Disassembler) label(param string) int {
+	if label, ok := d.labels[param]; ok {
+		return label
+	}
+
+	d.labels[param] = len(d.Labels)
+	d.Labels = append(d.Labels, param)
+	return d.labels[param]
+}
+
+// decodeOp finds the instruction type which code at start begins with. Since
+// the encodings are prefix free, at most one of them matches.
+func (d *Disassembler) decodeOp(start int) (compiler.InstructionType, bool) {
+	rest := d.code[start:]
+	for _, op := range compiler.Opcodes {
+		if strings.HasPrefix(rest, string(op)) {
+			return op, true
+		}
+	}
+
+	for n := 1; n <= len(rest); n++ {
+		if !isOpcodePrefix(rest[:n]) {
+			d.disassembleError(start, fmt.Sprintf("Unknown instruction '%s'.", rest[:n]))
+			return "", false
+		}
+	}
+	d.disassembleError(start, "Unexpected end of input.")
+	return "", false
+}
+
+func isOpcodePrefix(code string) bool {
+	for _, op := range compiler.Opcodes {
+		if strings.HasPrefix(string(op), code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourcePos returns the line and column in the source of the character at
+// index of code.
+func (d *Disassembler) sourcePos(index int) compiler.SourcePos {
+	offset := d.offsets[index]
+	lineStart := strings.LastIndexByte(d.source[:offset], '\n') + 1
+	return compiler.SourcePos{
+		Filename: d.filename,
+		Line:     strings.Count(d.source[:offset], "\n") + 1,
+		Column:   offset - lineStart + 1,
+	}
+}
+
+func (d *Disassembler) disassembleError(index int, message string) {
+	offset := len(d.source)
+	if index < len(d.offsets) {
+		offset = d.offsets[index]
+	}
+	line := strings.Count(d.source[:offset], "\n") + 1
+	d.Errors = append(
+		d.Errors,
+		fmt.Sprintf("%s:%d Error at byte %d: %s\n", d.filename, line, offset, message),
+	)
+}
+
+// Format writes instructions as assembly which the Assembler accepts, with
+// the offset of each instruction in a comment. Labels are named L_ followed
+// by their bits in labels.
+func Format(instructions []compiler.Instruction, labels []string) string {
+	return compiler.Listing(instructions, func(label int) string { return "L_" + labels[label] })
+}
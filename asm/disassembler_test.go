@@ -0,0 +1,92 @@
+package asm
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	input := "FFFLLTTFFFT\nFTFLTFLFFLLTLF\nFFTFTFTTFFLTTTTTFFLFTTLT"
+	expects := `  push 3             // 0
+label L_F            // 1
+  dup                // 2
+  putn               // 3
+  push -1            // 4
+  add                // 5
+  jump L_F           // 6
+label L_L            // 7
+  end                // 8
+label L_LF           // 9
+  ret                // 10
+`
+
+	disassembler := NewDisassembler("script", input)
+	instructions := disassembler.Disassemble()
+	if disassembler.HadErrors() {
+		t.Fatalf("Disassemble error occurred. %v", disassembler.Errors)
+	}
+
+	if actual := Format(instructions, disassembler.Labels); actual != expects {
+		t.Fatalf("disassembly wrong. expected=%q, got=%q", expects, actual)
+	}
+}
+
+func TestDisassembleLabels(t *testing.T) {
+	// jump FL, label L, push 1, putn, end, label FL, push 2, putn, end,
+	// then the empty label and label F, which are different labels too.
+	input := "TFTFLT TFFLT FFFLT LTFL TTT TFFFLT FFFLFT LTFL TTT TFFT TFFFT TFTT"
+	expects := `  jump L_FL          // 0
+label L_L            // 1
+  push 1             // 2
+  putn               // 3
+  end                // 4
+label L_FL           // 5
+  push 2             // 6
+  putn               // 7
+  end                // 8
+label L_             // 9
+label L_F            // 10
+  jump L_            // 11
+`
+
+	disassembler := NewDisassembler("script", input)
+	instructions := disassembler.Disassemble()
+	if disassembler.HadErrors() {
+		t.Fatalf("Disassemble error occurred. %v", disassembler.Errors)
+	}
+
+	output := Format(instructions, disassembler.Labels)
+	if output != expects {
+		t.Fatalf("disassembly wrong. expected=%q, got=%q", expects, output)
+	}
+
+	assembler := New("script.ffasm", output)
+	reassembled := assembler.Assemble()
+	if assembler.HadErrors() {
+		t.Fatalf("Assemble error occurred. %v", assembler.Errors)
+	}
+	if reassembled[0].Label != reassembled[5].Label || reassembled[11].Label != reassembled[9].Label {
+		t.Fatalf("jumps are reassembled to wrong labels. got=%+v", reassembled)
+	}
+}
+
+func TestDisassembleErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"FTF\nFLL", "script:2 Error at byte 4: Unknown instruction 'FLL'.\n"},
+		{"LFFFFFT", "script:1 Error at byte 6: Expect sign of number.\n"},
+		{"FTFFFFLL", "script:1 Error at byte 3: Unterminated number.\n"},
+		{"TFFLFL", "script:1 Error at byte 0: Unterminated label.\n"},
+		{"FTF\nLT", "script:2 Error at byte 4: Unexpected end of input.\n"},
+	}
+
+	for i, tt := range tests {
+		disassembler := NewDisassembler("script", tt.input)
+		disassembler.Disassemble()
+		if len(disassembler.Errors) != 1 {
+			t.Fatalf("tests[%d] - Disassemble errors count does not match. %v", i, disassembler.Errors)
+		}
+		if disassembler.Errors[0] != tt.expect {
+			t.Fatalf("tests[%d] - error wrong. expected=%q, got=%q", i, tt.expect, disassembler.Errors[0])
+		}
+	}
+}
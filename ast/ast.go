@@ -15,13 +15,19 @@ type StatementVisitor interface {
 	VisitWhile(s While)
 	VisitBlock(s Block)
 	VisitExpression(s ExpressionStatement)
+	VisitAssert(s Assert)
+	VisitAsmStatement(s AsmStatement)
 }
 
 type Var struct {
 	Identifier token.Token
+	Type       *TypeAnnotation
+	Module     string
 	IsLocal    bool
 	ScopeDepth int
 	LocalIndex int
+	// Slot is the offset of the local variable in the call frame.
+	Slot       int
 	Expression Expression
 }
 
@@ -30,16 +36,37 @@ func (v Var) Visit(visitor StatementVisitor) {
 }
 
 type Function struct {
-	Name   token.Token
-	Params []token.Token
-	Body   []Statement
+	Name       token.Token
+	Module     string
+	Exported   bool
+	Params     []token.Token
+	ParamTypes []*TypeAnnotation
+	ReturnType *TypeAnnotation
+	Body       []Statement
 }
 
 func (f Function) Visit(visitor StatementVisitor) {
 	visitor.VisitFunction(f)
 }
 
+// TypeAnnotation is a declared type such as `int` or `[char]`.
+// Token is the type name, or '[' with Elem for array types.
+// Omitted annotations are nil.
+type TypeAnnotation struct {
+	Token token.Token
+	Elem  *TypeAnnotation
+}
+
+func (t *TypeAnnotation) String() string {
+	if t.Elem != nil {
+		return "[" + t.Elem.String() + "]"
+	}
+
+	return t.Token.Literal
+}
+
 type Return struct {
+	Token token.Token
 	Value Expression
 }
 
@@ -90,6 +117,26 @@ func (e ExpressionStatement) Visit(visitor StatementVisitor) {
 	visitor.VisitExpression(e)
 }
 
+type Assert struct {
+	Token     token.Token
+	Condition Expression
+	Message   string
+}
+
+func (a Assert) Visit(visitor StatementVisitor) {
+	visitor.VisitAssert(a)
+}
+
+// AsmStatement is an asm block used as a statement. The values it leaves on
+// the stack stay there until another asm block consumes them.
+type AsmStatement struct {
+	Asm Asm
+}
+
+func (a AsmStatement) Visit(visitor StatementVisitor) {
+	visitor.VisitAsmStatement(a)
+}
+
 type Expression interface {
 	Visit(visitor ExpressionVisitor)
 }
@@ -106,6 +153,7 @@ type ExpressionVisitor interface {
 	VisitArrayLiteral(e ArrayLiteral)
 	VisitStringLiteral(e StringLiteral)
 	VisitIndex(i Index)
+	VisitAsm(a Asm)
 }
 
 type Assignable interface {
@@ -146,11 +194,18 @@ func (u Unary) Visit(visitor ExpressionVisitor) {
 	visitor.VisitUnaryExpression(u)
 }
 
+// Call is a function call. Namespace is the import alias of a qualified call
+// such as `arr.stable_sort(x)`, and Module is the module whose function
+// is called. Both are empty in the main program.
 type Call struct {
 	Callee    token.Token
+	Namespace token.Token
+	Module    string
 	Arguments []Expression
 }
 
+func (c Call) IsQualified() bool { return c.Namespace.Type == token.IDENT }
+
 func (c Call) Visit(visitor ExpressionVisitor) {
 	visitor.VisitCall(c)
 }
@@ -184,9 +239,11 @@ func (l BooleanLiteral) Visit(visitor ExpressionVisitor) {
 
 type Variable struct {
 	Identifier    token.Token
+	Module        string
 	Type          VariableType
 	ScopeDepth    int
 	LocalIndex    int
+	Slot          int
 	ArgumentIndex int
 	RelativeIndex int
 }
@@ -209,6 +266,7 @@ func (v Variable) VisitAssign(visitor AssignableVisitor) {
 }
 
 type ArrayLiteral struct {
+	Token    token.Token
 	Elements []Expression
 }
 
@@ -226,6 +284,7 @@ func (s StringLiteral) Visit(visitor ExpressionVisitor) {
 }
 
 type Index struct {
+	Token    token.Token
 	Receiver Expression
 	Index    Expression
 }
@@ -239,3 +298,27 @@ func (i Index) CanAssign() bool { return true }
 func (i Index) VisitAssign(visitor AssignableVisitor) {
 	visitor.VisitAssignToIndex(i)
 }
+
+// Asm is a block of FFLT instructions written as mnemonics. In and Out are
+// the numbers of values the block pops from and pushes onto the stack.
+// Module is the module whose functions are called by the block.
+type Asm struct {
+	Token        token.Token
+	Module       string
+	In           int
+	Out          int
+	Instructions []AsmInstruction
+}
+
+func (a Asm) Visit(visitor ExpressionVisitor) {
+	visitor.VisitAsm(a)
+}
+
+// AsmInstruction is an instruction of an asm block. Operand is the number,
+// the label name or the function name following the mnemonic, and has no
+// type if it is omitted. Value is the number.
+type AsmInstruction struct {
+	Mnemonic token.Token
+	Operand  token.Token
+	Value    int64
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/simomu-github/sfflt_lang/asm"
 	"github.com/simomu-github/sfflt_lang/ast"
 	"github.com/simomu-github/sfflt_lang/compiler"
 	"github.com/simomu-github/sfflt_lang/formatter"
@@ -16,25 +19,91 @@ import (
 )
 
 var (
-	versionOpt = flag.Bool("v", false, "display version information")
-	formatOpt  = flag.String("format", "64", "output code format. [oneline, pretty, (number of column)]")
-	outputOpt  = flag.String("output", "", "output script name.")
+	versionOpt   = flag.Bool("v", false, "display version information")
+	formatOpt    = flag.String("format", "64", "output code format. [oneline, pretty, (number of column)]")
+	outputOpt    = flag.String("output", "", "output script name.")
+	typecheckOpt = flag.Bool("typecheck", false, "check types before compiling.")
+	nogcOpt      = flag.Bool("nogc", false, "disable the garbage collector.")
+	checkedOpt   = flag.Bool("checked", false, "check array bounds and division by zero at runtime.")
+	inlineOpt    = flag.Int("inline", 20, "inline functions up to this size at call sites. (0 disables inlining)")
+	printOpt     = flag.String("print-after", "", "print the program after the pass.")
+	sourceMapOpt = flag.Bool("source-map", false, "write the source map into the output file name followed by .map.")
 )
 
+// passOpts enable or disable the passes named by them.
+var passOpts = map[string]*bool{
+	"constant-folding":  flag.Bool("constant-folding", false, "evaluate constant expressions before compiling."),
+	"dead-code":         flag.Bool("dead-code", false, "remove unused functions, globals and unreachable statements."),
+	"branch-conditions": flag.Bool("branch-conditions", false, "jump on comparisons in conditions without materializing booleans."),
+	"peephole":          flag.Bool("peephole", false, "rewrite wasteful instruction sequences."),
+	"compact-labels":    flag.Bool("compact-labels", false, "thread jumps and give the most used labels the shortest encodings."),
+}
+
+// levelOpt is the optimization level. The passes given by their flags are
+// enabled or disabled regardless of it.
+var levelOpt = compiler.O1
+
+// levelFlag sets the optimization level. The last one given wins.
+type levelFlag compiler.OptimizationLevel
+
+func (l levelFlag) String() string   { return "" }
+func (l levelFlag) IsBoolFlag() bool { return true }
+
+func (l levelFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if enabled {
+		levelOpt = compiler.OptimizationLevel(l)
+	}
+	return err
+}
+
+var includePathsOpt includePaths
+
 const version = "v0.0.2"
 
+type includePaths []string
+
+func (i *includePaths) String() string {
+	return strings.Join(*i, string(os.PathListSeparator))
+}
+
+func (i *includePaths) Set(dir string) error {
+	*i = append(*i, dir)
+	return nil
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: sfflt_lang (option) [FILE]\n")
+		fmt.Fprintf(os.Stderr, "       sfflt_lang asm (option) [FILE]\n")
+		fmt.Fprintf(os.Stderr, "       sfflt_lang disasm (option) [FILE]\n")
 		flag.PrintDefaults()
 	}
 
+	flag.Var(&includePathsOpt, "I", "add directory to search included files. (can be repeated)")
+	flag.Var(levelFlag(compiler.O0), "O0", "disable optimizations.")
+	flag.Var(levelFlag(compiler.O1), "O1", "fold constants and eliminate dead code. (default)")
+	flag.Var(levelFlag(compiler.O2), "O2", "enable every optimization.")
+	flag.Var(levelFlag(compiler.Os), "Os", "enable the optimizations which do not grow the output.")
 	flag.Parse()
 	if *versionOpt {
 		fmt.Printf("sfflt_lang version %s\n", version)
 		os.Exit(0)
 	}
 
+	if flag.NArg() > 0 && (flag.Arg(0) == "asm" || flag.Arg(0) == "disasm") {
+		command := flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if command == "asm" {
+			os.Exit(Assemble(flag.Arg(0)))
+		}
+		os.Exit(Disassemble(flag.Arg(0)))
+	}
+
 	if len(flag.Args()) == 1 {
 		filepath := flag.Args()[0]
 		stmts, err := Parse(filepath)
@@ -58,10 +127,11 @@ func Parse(path string) ([]ast.Statement, error) {
 
 	lexer := lexer.New(path, string(bytes))
 	parser := parser.New(lexer)
+	parser.IncludePaths = append(includePathsOpt, filepath.SplitList(os.Getenv("SFFLT_PATH"))...)
 	statements := parser.ParseProgram()
 	if parser.HadErrors() {
 		for _, err := range parser.Errors {
-			fmt.Fprintf(os.Stderr, err)
+			fmt.Fprint(os.Stderr, err)
 		}
 		return nil, errors.New("parse error.")
 	}
@@ -70,17 +140,102 @@ func Parse(path string) ([]ast.Statement, error) {
 	resolver.Resolve()
 	if resolver.HadErrors() {
 		for _, err := range resolver.Errors {
-			fmt.Fprintf(os.Stderr, err)
+			fmt.Fprint(os.Stderr, err)
 		}
 		return nil, errors.New("resolve error.")
 	}
 
+	if *typecheckOpt {
+		checker := compiler.NewTypeChecker(path, statements)
+		checker.Check()
+		if checker.HadErrors() {
+			for _, err := range checker.Errors {
+				fmt.Fprint(os.Stderr, err)
+			}
+			return nil, errors.New("type error.")
+		}
+	}
+
 	return statements, nil
 }
 
 func Compile(path string, statements []ast.Statement) int {
+	passes, err := PassManager()
+	if err != nil {
+		return 1
+	}
+
 	compiler := compiler.New(statements)
-	output, err := FormatInstructions(compiler.Compile())
+	compiler.DisableGC = *nogcOpt
+	compiler.Checked = *checkedOpt
+	compiler.Passes = passes
+	compiler.BranchConditions = passes.Enabled("branch-conditions")
+	if passes.Enabled("inline") {
+		compiler.InlineThreshold = *inlineOpt
+	}
+	instructions := compiler.Compile()
+	if compiler.HadErrors() {
+		for _, err := range compiler.Errors {
+			fmt.Fprint(os.Stderr, err)
+		}
+		return 1
+	}
+
+	return WriteInstructions(path, instructions)
+}
+
+// Assemble converts the mnemonic assembly in path into FFLT.
+func Assemble(path string) int {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	assembler := asm.New(path, string(bytes))
+	instructions := assembler.Assemble()
+	if assembler.HadErrors() {
+		for _, err := range assembler.Errors {
+			fmt.Fprint(os.Stderr, err)
+		}
+		return 1
+	}
+
+	return WriteInstructions(path, instructions)
+}
+
+// Disassemble converts the FFLT in path into mnemonic assembly, which is
+// printed unless the output file is given.
+func Disassemble(path string) int {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	disassembler := asm.NewDisassembler(path, string(bytes))
+	output := asm.Format(disassembler.Disassemble(), disassembler.Labels)
+	if disassembler.HadErrors() {
+		for _, err := range disassembler.Errors {
+			fmt.Fprint(os.Stderr, err)
+		}
+		return 1
+	}
+
+	if *outputOpt == "" {
+		fmt.Print(output)
+	} else {
+		os.WriteFile(*outputOpt, []byte(output), 0644)
+	}
+
+	return 0
+}
+
+// WriteInstructions writes the instructions formatted into the output file,
+// which is named after path unless it is given, and its source map if it is
+// enabled.
+func WriteInstructions(path string, instructions []compiler.Instruction) int {
+	output, err := FormatInstructions(instructions)
 	if err != nil {
 		return 1
 	}
@@ -92,10 +247,42 @@ func Compile(path string, statements []ast.Statement) int {
 	}
 	os.WriteFile(outputFilename, []byte(output), 0644)
 
+	if *sourceMapOpt {
+		sourceMap := compiler.NewSourceMap(filepath.Base(outputFilename), instructions, output)
+		bytes, err := json.Marshal(sourceMap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		os.WriteFile(outputFilename+".map", bytes, 0644)
+	}
+
 	return 0
 }
 
-func FormatInstructions(instructions []string) (string, error) {
+// PassManager enables the passes of the optimization level, and then the
+// passes given by their flags.
+func PassManager() (*compiler.PassManager, error) {
+	passes := compiler.NewPassManager(levelOpt)
+	flag.Visit(func(f *flag.Flag) {
+		if opt, ok := passOpts[f.Name]; ok {
+			passes.SetEnabled(f.Name, *opt)
+		} else if f.Name == "inline" {
+			passes.SetEnabled(f.Name, *inlineOpt > 0)
+		}
+	})
+
+	if *printOpt != "" && !passes.HasPass(*printOpt) {
+		fmt.Fprintf(os.Stderr, "Unknown pass '%s'.\n", *printOpt)
+		return nil, errors.New("unknown pass.")
+	}
+	passes.PrintAfter = *printOpt
+
+	return passes, nil
+}
+
+func FormatInstructions(program []compiler.Instruction) (string, error) {
+	instructions := compiler.Encode(program)
 	switch *formatOpt {
 	case "oneline":
 		return formatter.FormatOneLine(instructions), nil
@@ -0,0 +1,204 @@
+package compiler
+
+// Every heap block is recorded in two tables indexed by its offset from
+// HEAP_ADDR. The block table holds the size of the block, so the heap can be
+// walked from HEAP_ADDR to the allocation pointer, and the mark table holds
+// one of the states below.
+const (
+	BLOCK_UNMARKED = int64(0)
+	BLOCK_MARKED   = int64(1)
+	BLOCK_FREE     = int64(2)
+)
+
+// callAllocate allocates the number of cells on the top of the stack with the
+// allocation routine. With the collector, the values of the current frame are
+// spilled first because the routine may run a collection.
+func (c *Compiler) callAllocate() {
+	if !c.DisableGC {
+		c.spillStack(1)
+		c.pushFrameTop()
+		c.addInstruction(SWAP)
+	}
+
+	if c.allocateLabel == noLabel {
+		c.allocateLabel = c.newLabel()
+	}
+	c.addInstructionWithLabel(CALLSUB, c.allocateLabel)
+}
+
+func (c *Compiler) freeRoutineLabel() int {
+	if c.freeLabel == noLabel {
+		c.freeLabel = c.newLabel()
+	}
+
+	return c.freeLabel
+}
+
+// allocatorRoutines emits the allocation and free routines, and the
+// collector unless it is disabled, after all functions.
+func (c *Compiler) allocatorRoutines() {
+	if c.allocateLabel == noLabel {
+		c.allocateLabel = c.newLabel()
+	}
+	c.freeRoutineLabel()
+
+	if c.DisableGC {
+		c.allocateRoutine(noLabel)
+		c.freeRoutine()
+		return
+	}
+
+	collectLabel := c.newLabel()
+	markLabel := c.newLabel()
+	c.allocateRoutine(collectLabel)
+	c.freeRoutine()
+	c.collectRoutine(collectLabel, markLabel)
+	c.markRoutine(markLabel)
+}
+
+// allocateRoutine emits _allocate([frame_top,] size). Blocks are rounded up to
+// a power of two, and a block freed to the list of its size class is reused
+// before the allocation pointer is bumped. With the collector, a collection
+// runs first once GC_THRESHOLD cells are allocated since the last one.
+func (c *Compiler) allocateRoutine(collectLabel int) {
+	c.addInstructionWithLabel(LABEL, c.allocateLabel)
+
+	if collectLabel != noLabel {
+		c.addInstructionWithArg(PUSH, VM_ALLOCATED)
+		c.addInstruction(RETRIEVE)
+		c.addInstructionWithArg(COPY, 1) // size
+		c.addInstruction(ADD)
+		c.addInstruction(DUP)
+		c.addInstructionWithArg(PUSH, VM_ALLOCATED)
+		c.addInstruction(SWAP)
+		c.addInstruction(STORE) // update allocated cells
+
+		c.addInstructionWithArg(PUSH, GC_THRESHOLD)
+		c.addInstruction(SUB)
+		skipCollectPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+
+		c.addInstructionWithArg(COPY, 1) // frame_top
+		c.addInstructionWithLabel(CALLSUB, collectLabel)
+		c.addInstructionWithArg(PUSH, VM_ALLOCATED)
+		c.addInstructionWithArg(COPY, 1) // size
+		c.addInstruction(STORE)
+
+		skipCollectLabel := c.markJumpLabel()
+		c.confirmJumpLabel(skipCollectPos, skipCollectLabel)
+		c.addInstructionWithArg(SLIDE, 1)
+	}
+
+	c.sizeClass()
+
+	// pop the free list of the size class
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE) // block
+	c.addInstruction(DUP)
+	bumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE)       // next
+	c.addInstructionWithArg(COPY, 2) // free list
+	c.addInstruction(SWAP)
+	c.addInstruction(STORE)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstructionWithArg(PUSH, BLOCK_UNMARKED)
+	c.addInstruction(STORE)
+	c.addInstructionWithArg(SLIDE, 3)
+	c.addInstruction(ENDSUB)
+
+	bumpLabel := c.markJumpLabel()
+	c.confirmJumpLabel(bumpPos, bumpLabel)
+	c.addInstruction(DISCARD)
+	c.addInstruction(DISCARD)
+	c.addInstructionWithArg(PUSH, VM_ALLOC_REC)
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(COPY, 2) // block size
+	c.addInstruction(ADD)
+	c.addInstructionWithArg(PUSH, VM_ALLOC_REC)
+	c.addInstruction(SWAP)
+	c.addInstruction(STORE)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_BLOCK_TABLE)
+	c.addInstructionWithArg(COPY, 2) // block size
+	c.addInstruction(STORE)
+	c.addInstructionWithArg(SLIDE, 2)
+	c.addInstruction(ENDSUB)
+}
+
+// freeRoutine emits _free(block), which pushes the block to the free list of
+// its size class. Values which are not allocated blocks are ignored, so a
+// block is never linked twice.
+func (c *Compiler) freeRoutine() {
+	c.addInstructionWithLabel(LABEL, c.freeLabel)
+
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_BLOCK_TABLE)
+	c.addInstruction(RETRIEVE)
+	notBlockPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstruction(RETRIEVE)
+	c.addInstructionWithArg(PUSH, BLOCK_FREE)
+	c.addInstruction(SUB)
+	freedPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstructionWithArg(PUSH, BLOCK_FREE)
+	c.addInstruction(STORE)
+
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_BLOCK_TABLE)
+	c.addInstruction(RETRIEVE)
+	c.sizeClass()
+	c.addInstructionWithArg(SLIDE, 2)
+
+	c.addInstructionWithArg(COPY, 1) // block
+	c.addInstructionWithArg(COPY, 1) // free list
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(STORE)          // link the next block
+	c.addInstructionWithArg(COPY, 1) // block
+	c.addInstruction(STORE)
+
+	doneLabel := c.markJumpLabel()
+	c.confirmJumpLabel(notBlockPos, doneLabel)
+	c.confirmJumpLabel(freedPos, doneLabel)
+	c.addInstruction(DISCARD)
+	c.addInstruction(ENDSUB)
+}
+
+// sizeClass pushes the smallest power of two not less than the size on the
+// top of the stack, and the address of the free list for that size.
+func (c *Compiler) sizeClass() {
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstructionWithArg(PUSH, VM_SIZE_CLASSES)
+
+	loopLabel := c.markJumpLabel()
+	c.addInstructionWithArg(COPY, 1) // block size
+	c.addInstructionWithArg(COPY, 3) // size
+	c.addInstruction(SUB)
+	growPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	endPos := c.reserveJumpLabel(JUMP)
+
+	growLabel := c.markJumpLabel()
+	c.confirmJumpLabel(growPos, growLabel)
+	c.addInstruction(SWAP)
+	c.addInstructionWithArg(PUSH, 2)
+	c.addInstruction(MUL)
+	c.addInstruction(SWAP)
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstruction(ADD)
+	c.addInstructionWithLabel(JUMP, loopLabel)
+
+	endLabel := c.markJumpLabel()
+	c.confirmJumpLabel(endPos, endLabel)
+}
+
+// pushTableAddress converts the block address on the top of the stack into
+// the address of its entry in table.
+func (c *Compiler) pushTableAddress(table int64) {
+	c.addInstructionWithArg(PUSH, table-HEAP_ADDR)
+	c.addInstruction(ADD)
+}
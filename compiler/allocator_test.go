@@ -0,0 +1,61 @@
+package compiler
+
+import "testing"
+
+func TestCompileFree(t *testing.T) {
+	input := "free(\"\");"
+	instructions := compileWithoutGC(input, t)
+	expects := []string{
+		"FFFLFT", // push 2 ( length * 2 + 2 )
+		"TFLFT",  // call allocate
+
+		// setup string
+		"FTF",   // dup
+		"FFFFT", // push 0
+		"LLF",   // store
+		"FTF",   // dup
+		"FFFLT", // push 1
+		"LFFF",  // add
+		"FFFFT", // push 0
+		"LLF",   // store
+
+		"TFLLT", // call free
+		"FFFFT", // push 0
+		"FTT",   // discard
+		"TTT",   // end
+
+		"TFFFT", // mark label allocate
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestAllocatorReusesFreedBlocks(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		// A freed block is reused by the next block of its size class.
+		{"var a = [1, 2, 3]; free(a); var b = [4, 5, 6]; putn(a == b);", "1"},
+		{"var a = [1, 2, 3]; free(a); var b = [4, 5, 6, 7, 8, 9, 10]; putn(a == b);", "0"},
+		// append frees the original array only when it regrows it. [1, 2] has
+		// room for 4 elements.
+		{
+			"var a = [1, 2]; var b = append(append(append(a, 3), 4), 5); var c = [6, 7];" +
+				"putn(a == b); putn(a == c);",
+			"01",
+		},
+		{
+			"var a = [1, 2]; var b = append(a, 3); var c = [4, 5];" +
+				"putn(a == b); putn(a == c); putn(len(a)); putn(a[0]); putn(a[1]); putn(a[2]);",
+			"103123",
+		},
+	}
+
+	for i, tt := range tests {
+		output := execute(decodeInstructions(compileWithoutGC(tt.input, t)), t)
+		if output != tt.expect {
+			t.Fatalf("tests[%d] - output wrong. expected=%q, got=%q", i, tt.expect, output)
+		}
+	}
+}
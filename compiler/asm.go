@@ -0,0 +1,73 @@
+package compiler
+
+import "github.com/simomu-github/sfflt_lang/ast"
+
+// asm compiles the instructions of an asm block checked by the Resolver.
+// Labels are local to the block, and call moves the frame pointer as a call
+// of the function in the program does.
+func (c *Compiler) asm(a ast.Asm) {
+	labels := map[string]int{}
+	for _, instruction := range a.Instructions {
+		if instruction.Mnemonic.Literal == mnemonics[LABEL] {
+			labels[instruction.Operand.Literal] = c.newLabel()
+		}
+	}
+
+	// depth is the number of values the block has pushed so far, counted in
+	// the order of the instructions. It is negative once the block has taken
+	// its inputs.
+	depth := 0
+	for _, instruction := range a.Instructions {
+		c.asmInstruction(instruction, labels, a.Module, depth)
+		depth += c.asmStackEffect(instruction, a.Module)
+	}
+}
+
+func (c *Compiler) asmInstruction(instruction ast.AsmInstruction, labels map[string]int, module string, depth int) {
+	defer c.at(instruction.Mnemonic)()
+
+	op, _ := LookupMnemonic(instruction.Mnemonic.Literal)
+	switch {
+	case op == CALLSUB:
+		// The values of the frame below the arguments are spilled as
+		// VisitCall does, including those the block has pushed.
+		arity := c.functionArities[mangle(module, instruction.Operand.Literal)]
+		if held := c.currentFrame().stack + depth - arity; held > 0 {
+			c.spillValues(held, arity)
+		}
+
+		label := c.functionLabel(instruction.Operand.Literal, module)
+		c.pushCallSite(ast.Call{Callee: instruction.Operand, Module: module})
+		c.beforeCall()
+		c.addInstructionWithLabel(CALLSUB, label)
+		c.afterCall()
+		c.popCallSite()
+	case op.HasArg():
+		c.addInstructionWithArg(op, instruction.Value)
+	case op.HasLabel():
+		c.addInstructionWithLabel(op, labels[instruction.Operand.Literal])
+	default:
+		c.addInstruction(op)
+	}
+}
+
+// asmStackEffect returns the number of values an instruction pushes minus the
+// number of values it pops. A call pops the arguments of the function and
+// pushes its return value.
+func (c *Compiler) asmStackEffect(instruction ast.AsmInstruction, module string) int {
+	op, _ := LookupMnemonic(instruction.Mnemonic.Literal)
+	switch op {
+	case PUSH, DUP, COPY:
+		return 1
+	case DISCARD, ADD, SUB, MUL, DIV, MOD, GETC, GETN, PUTC, PUTN, JUMP_WHEN_ZERO, JUMP_WHEN_NEGA:
+		return -1
+	case SLIDE:
+		return -int(instruction.Value)
+	case STORE:
+		return -2
+	case CALLSUB:
+		return 1 - c.functionArities[mangle(module, instruction.Operand.Literal)]
+	}
+
+	return 0
+}
@@ -1,13 +1,17 @@
 package compiler
 
+import "github.com/simomu-github/sfflt_lang/ast"
+
 var buildinFunctions = map[string]*BuildInFunction{
-	"putn":   {f: putn, arity: 1},
-	"putc":   {f: putc, arity: 1},
-	"getn":   {f: getn, arity: 0},
-	"getc":   {f: getc, arity: 0},
-	"len":    {f: arrayLen, arity: 1},
-	"copy":   {f: arrayCopy, arity: 2},
-	"append": {f: arrayAppend, arity: 2},
+	"putn":   {f: putn, arity: 1, signature: putnSignature},
+	"putc":   {f: putc, arity: 1, signature: putcSignature},
+	"getn":   {f: getn, arity: 0, signature: getnSignature},
+	"getc":   {f: getc, arity: 0, signature: getcSignature},
+	"len":    {f: arrayLen, arity: 1, signature: lenSignature},
+	"copy":   {f: arrayCopy, arity: 2, signature: copySignature},
+	"append": {f: arrayAppend, arity: 2, signature: appendSignature},
+	"exit":   {f: exit, arity: 1, signature: exitSignature},
+	"free":   {f: free, arity: 1, signature: freeSignature},
 
 	"_allocate":   {f: allocate, arity: 1},
 	"_reallocate": {f: reallocate, arity: 2},
@@ -17,36 +21,60 @@ var buildinFunctions = map[string]*BuildInFunction{
 type BuildInFunction struct {
 	arity int
 	f     func(c *Compiler)
+	// signature returns fresh parameter and return types for each call.
+	// Functions without signature are not type checked.
+	signature func() ([]*Type, *Type)
+}
+
+// lookupBuildinFunction returns the build-in function called by e.
+// Qualified calls always refer to module functions.
+func lookupBuildinFunction(e ast.Call) (*BuildInFunction, bool) {
+	if e.IsQualified() {
+		return nil, false
+	}
+
+	b, ok := buildinFunctions[e.Callee.Literal]
+	return b, ok
 }
 
 func putn(c *Compiler) {
 	c.addInstruction(PUTN)
 	// return empty
-	c.addInstructionWithParam(PUSH, POSI+"F")
+	c.addInstructionWithArg(PUSH, 0)
 }
 
 func putc(c *Compiler) {
 	c.addInstruction(PUTC)
 	// return empty
-	c.addInstructionWithParam(PUSH, POSI+"F")
+	c.addInstructionWithArg(PUSH, 0)
 }
 
 func getn(c *Compiler) {
-	addr := intToBinary(VM_ADDR)
-	c.addInstructionWithParam(PUSH, POSI+addr)
+	c.addInstructionWithArg(PUSH, VM_ADDR)
 	c.addInstruction(GETN)
-	c.addInstructionWithParam(PUSH, POSI+addr)
+	c.addInstructionWithArg(PUSH, VM_ADDR)
 	c.addInstruction(RETRIEVE)
 }
 
 func getc(c *Compiler) {
-	addr := intToBinary(VM_ADDR)
-	c.addInstructionWithParam(PUSH, POSI+addr)
+	c.addInstructionWithArg(PUSH, VM_ADDR)
 	c.addInstruction(GETC)
-	c.addInstructionWithParam(PUSH, POSI+addr)
+	c.addInstructionWithArg(PUSH, VM_ADDR)
 	c.addInstruction(RETRIEVE)
 }
 
+// exit(code)
+func exit(c *Compiler) {
+	c.exit()
+}
+
+// free(array)
+func free(c *Compiler) {
+	c.addInstructionWithLabel(CALLSUB, c.freeRoutineLabel())
+	// return empty
+	c.addInstructionWithArg(PUSH, 0)
+}
+
 func arrayLen(c *Compiler) {
 	// fetch array pointer
 	c.addInstruction(RETRIEVE)
@@ -54,27 +82,27 @@ func arrayLen(c *Compiler) {
 
 // copy(source, dist)
 func arrayCopy(c *Compiler) {
-	c.addInstructionWithParam(PUSH, ZERO) // counter
+	c.addInstructionWithArg(PUSH, 0) // counter
 
 	jumpLabel := c.markJumpLabel()
 
 	// arg _memCopy(source, 0, dist, 0)
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // source
-	c.addInstructionWithParam(COPY, POSI+intToBinary(1)) // counter
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // dist
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // counter
+	c.addInstructionWithArg(COPY, 2) // source
+	c.addInstructionWithArg(COPY, 1) // counter
+	c.addInstructionWithArg(COPY, 3) // dist
+	c.addInstructionWithArg(COPY, 3) // counter
 
 	// call _memCopy(source, 0, dist, 0)
 	memCopy(c)
 	c.addInstruction(DISCARD)
 
 	// update counter
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // source
-	c.addInstruction(RETRIEVE)                           // source length
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(2))
+	c.addInstructionWithArg(COPY, 3) // source
+	c.addInstruction(RETRIEVE)       // source length
+	c.addInstructionWithArg(PUSH, 2)
 	c.addInstruction(ADD) // add array header length
 
 	c.addInstruction(SUB) // remaining
@@ -83,44 +111,46 @@ func arrayCopy(c *Compiler) {
 	c.confirmJumpLabel(jumpLabelPos, jumpLabel)
 
 	// return
-	c.addInstructionWithParam(PUSH, ZERO)
-	c.addInstructionWithParam(SLIDE, POSI+intToBinary(3))
+	c.addInstructionWithArg(PUSH, 0)
+	c.addInstructionWithArg(SLIDE, 3)
 
 }
 
 // append(array, element) array
 func arrayAppend(c *Compiler) {
-	c.addInstructionWithParam(COPY, POSI+intToBinary(1)) // array
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(COPY, 1) // array
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
 	c.addInstruction(RETRIEVE) // capacity
 
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // array
-	c.addInstruction(RETRIEVE)                           // length
+	c.addInstructionWithArg(COPY, 2) // array
+	c.addInstruction(RETRIEVE)       // length
 
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
 	c.addInstruction(SUB) // remain
 	reallocJumpPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
 
-	c.addInstructionWithParam(COPY, POSI+intToBinary(1)) // array
+	c.addInstructionWithArg(COPY, 1) // array
 	jumpLabelPos := c.reserveJumpLabel(JUMP)
 
 	// reallocate
 	reallocLabel := c.markJumpLabel()
 	c.confirmJumpLabel(reallocJumpPos, reallocLabel)
 
-	c.addInstructionWithParam(COPY, POSI+intToBinary(1)) // array
+	c.addInstructionWithArg(COPY, 1) // array
 
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // array
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(COPY, 2) // array
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
 	c.addInstruction(RETRIEVE) // capacity
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(2))
+	c.addInstructionWithArg(PUSH, 2)
 	c.addInstruction(MUL) // new capacity
 
 	// call _reallocate(array, capacity)
+	c.hold(2)
 	reallocate(c)
+	c.release(2)
 
 	jumpLabel := c.markJumpLabel()
 	c.confirmJumpLabel(jumpLabelPos, jumpLabel)
@@ -129,67 +159,60 @@ func arrayAppend(c *Compiler) {
 	c.addInstruction(DUP)
 	c.addInstruction(RETRIEVE) // length
 
-	c.addInstruction(DUP)                                // length
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // array
+	c.addInstruction(DUP)            // length
+	c.addInstructionWithArg(COPY, 2) // array
 	c.addInstruction(SWAP)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(2))
+	c.addInstructionWithArg(PUSH, 2)
 	c.addInstruction(ADD)
-	c.addInstruction(ADD)                                // array last
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // element
+	c.addInstruction(ADD)            // array last
+	c.addInstructionWithArg(COPY, 3) // element
 	c.addInstruction(STORE)
 
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
-	c.addInstructionWithParam(COPY, POSI+intToBinary(1)) // new_array
+	c.addInstructionWithArg(COPY, 1) // new_array
 	c.addInstruction(SWAP)
 	c.addInstruction(STORE) // update array length
 
 	// return
-	c.addInstructionWithParam(SLIDE, POSI+intToBinary(2))
+	c.addInstructionWithArg(SLIDE, 2)
 }
 
 // _memCopy(source, source_index, dist, dist_index)
 func memCopy(c *Compiler) {
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // source
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // source_index
+	c.addInstructionWithArg(COPY, 3) // source
+	c.addInstructionWithArg(COPY, 3) // source_index
 	c.addInstruction(ADD)
 	c.addInstruction(RETRIEVE)
 
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // dist
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // dist_index
+	c.addInstructionWithArg(COPY, 2) // dist
+	c.addInstructionWithArg(COPY, 2) // dist_index
 	c.addInstruction(ADD)
 
 	c.addInstruction(SWAP)
 
 	c.addInstruction(STORE)
-	c.addInstructionWithParam(PUSH, ZERO)
-	c.addInstructionWithParam(SLIDE, POSI+intToBinary(4))
+	c.addInstructionWithArg(PUSH, 0)
+	c.addInstructionWithArg(SLIDE, 4)
 }
 
 // _allocate(size)
 func allocate(c *Compiler) {
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_ALLOC_REC))
-	c.addInstruction(RETRIEVE)
-	c.addInstruction(DUP)
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2))
-	c.addInstruction(ADD)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_ALLOC_REC))
-	c.addInstruction(SWAP)
-	c.addInstruction(STORE)
-
-	c.addInstructionWithParam(SLIDE, ONE)
+	c.callAllocate()
 }
 
 // _reallocate(original_array, capacity)
 func reallocate(c *Compiler) {
 	// call _allocate(size)
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(2))
+	c.addInstructionWithArg(PUSH, 2)
 	c.addInstruction(ADD)
+	c.hold(2)
 	allocate(c)
+	c.release(2)
 
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(COPY, POSI+intToBinary(3)) // original
+	c.addInstructionWithArg(COPY, 3) // original
 	c.addInstruction(SWAP)
 
 	// call copy(source, dist)
@@ -198,12 +221,43 @@ func reallocate(c *Compiler) {
 
 	// update capacity
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
-	c.addInstructionWithParam(COPY, POSI+intToBinary(2)) // new capacity
+	c.addInstructionWithArg(COPY, 2) // new capacity
 	c.addInstruction(STORE)
 
+	// Without the collector nothing else would free the original array.
+	if c.DisableGC {
+		c.addInstructionWithArg(COPY, 2) // original
+		c.addInstructionWithLabel(CALLSUB, c.freeRoutineLabel())
+	}
+
 	// return
-	c.addInstructionWithParam(SLIDE, POSI+intToBinary(2))
+	c.addInstructionWithArg(SLIDE, 2)
+
+}
+
+func putnSignature() ([]*Type, *Type) { return []*Type{intType}, voidType }
+func putcSignature() ([]*Type, *Type) { return []*Type{charType}, voidType }
+func getnSignature() ([]*Type, *Type) { return []*Type{}, intType }
+func getcSignature() ([]*Type, *Type) { return []*Type{}, charType }
+func exitSignature() ([]*Type, *Type) { return []*Type{intType}, newTypeVariable() }
+
+func freeSignature() ([]*Type, *Type) {
+	return []*Type{newArrayType(newTypeVariable())}, voidType
+}
+
+func lenSignature() ([]*Type, *Type) {
+	return []*Type{newArrayType(newTypeVariable())}, intType
+}
+
+func copySignature() ([]*Type, *Type) {
+	elem := newTypeVariable()
+	return []*Type{newArrayType(elem), newArrayType(elem)}, voidType
+}
 
+func appendSignature() ([]*Type, *Type) {
+	elem := newTypeVariable()
+	array := newArrayType(elem)
+	return []*Type{array, elem}, array
 }
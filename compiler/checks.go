@@ -0,0 +1,92 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/token"
+)
+
+// boundsCheck checks the index on the top of the stack against the length of
+// the array below it in checked mode.
+func (c *Compiler) boundsCheck(tok token.Token) {
+	if !c.Checked {
+		return
+	}
+
+	c.addInstruction(DUP)
+	failPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(COPY, 2) // array
+	c.addInstruction(RETRIEVE)       // length
+	c.addInstruction(SUB)
+	okPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+
+	failLabel := c.markJumpLabel()
+	c.confirmJumpLabel(failPos, failLabel)
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(COPY, 2) // array
+	c.addInstruction(RETRIEVE)       // length
+	if c.indexErrorLabel == noLabel {
+		c.indexErrorLabel = c.newLabel()
+	}
+	c.addInstructionWithLabel(CALLSUB, c.indexErrorLabel)
+	c.runtimeError(tok)
+
+	okLabel := c.markJumpLabel()
+	c.confirmJumpLabel(okPos, okLabel)
+}
+
+// divisionCheck checks the divisor on the top of the stack in checked mode.
+func (c *Compiler) divisionCheck(tok token.Token) {
+	if !c.Checked {
+		return
+	}
+
+	c.addInstruction(DUP)
+	failPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	okPos := c.reserveJumpLabel(JUMP)
+
+	failLabel := c.markJumpLabel()
+	c.confirmJumpLabel(failPos, failLabel)
+	c.putString("division by zero at ")
+	c.runtimeError(tok)
+
+	okLabel := c.markJumpLabel()
+	c.confirmJumpLabel(okPos, okLabel)
+}
+
+// constantDivisor reports division by a literal zero at compile time.
+func (c *Compiler) constantDivisor(e ast.Binary) {
+	divisor := e.Right
+	if u, ok := divisor.(ast.Unary); ok && u.Operator.Type == token.MINUS {
+		divisor = u.Right
+	}
+
+	if i, ok := divisor.(ast.IntegerLiteral); ok && i.Value == 0 {
+		c.compileError(e.Operator, "Division by zero.")
+	}
+}
+
+// runtimeError finishes the error message with the position of tok, prints
+// the stack trace and terminates the program.
+func (c *Compiler) runtimeError(tok token.Token) {
+	c.putString(fmt.Sprintf("%s:%d\n", tok.Filename, tok.Line))
+	c.callStackTrace()
+	c.addInstructionWithArg(PUSH, 1)
+	c.exit()
+}
+
+// indexErrorRoutine emits _indexError(index, length), which writes the
+// message of an out of range index up to its position.
+func (c *Compiler) indexErrorRoutine() {
+	c.addInstructionWithLabel(LABEL, c.indexErrorLabel)
+
+	c.putString("index out of range [")
+	c.addInstruction(SWAP)
+	c.addInstruction(PUTN)
+	c.putString("] with length ")
+	c.addInstruction(PUTN)
+	c.putString(" at ")
+	c.addInstruction(ENDSUB)
+}
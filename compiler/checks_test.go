@@ -0,0 +1,111 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/simomu-github/sfflt_lang/lexer"
+	"github.com/simomu-github/sfflt_lang/parser"
+)
+
+func TestCompileBoundsCheck(t *testing.T) {
+	input := "var a = [1]; a[0];"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Checked = true }, t)
+	expects := []string{
+		"FFFLFFFFFFFFFFFFFFFFFFT", // push a address
+		"FFFLFFT",                 // push 4 ( length * 2 + 2 )
+		"TFLFT",                   // call allocate
+
+		// setup array
+		"FTF",    // dup
+		"FFFLT",  // push 1
+		"LLF",    // store
+		"FTF",    // dup
+		"FFFLT",  // push 1
+		"LFFF",   // add
+		"FFFLFT", // push 2
+		"LLF",    // store
+		"FTF",    // dup
+		"FFFLFT", // push 2
+		"LFFF",   // add
+		"FFFLT",  // push 1
+		"LLF",    // store
+		"LLF",    // store a
+
+		"FFFLFFFFFFFFFFFFFFFFFFT", // push a address
+		"LLL",                     // retrieve
+		"FFFFT",                   // push 0
+
+		// bounds check
+		"FTF",     // dup
+		"TLLLT",   // jump fail when negative
+		"FTF",     // dup
+		"FLFFLFT", // copy 2 (array)
+		"LLL",     // retrieve length
+		"LFFL",    // sub
+		"TLLLFLT", // jump ok when negative
+
+		"TFFLT",   // mark label fail
+		"FTF",     // dup
+		"FLFFLFT", // copy 2 (array)
+		"LLL",     // retrieve length
+		"TFLLFT",  // call index error
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileDivisionCheck(t *testing.T) {
+	input := "6 / 3;"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Checked = true }, t)
+	expects := []string{
+		"FFFLLFT", // push 6
+		"FFFLLT",  // push 3
+
+		// division check
+		"FTF",    // dup
+		"TLFFT",  // jump fail when zero
+		"TFTLLT", // jump ok
+		"TFFFT",  // mark label fail
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileDivisionByZero(t *testing.T) {
+	for _, input := range []string{"1 / 0;", "1 % -0;"} {
+		lexer := lexer.New("script", input)
+		parser := parser.New(lexer)
+		compiler := New(parser.ParseProgram())
+		compiler.Compile()
+
+		if !compiler.HadErrors() {
+			t.Fatalf("No error occurs. %s", input)
+		}
+
+		if !strings.Contains(compiler.Errors[0], "Division by zero.") {
+			t.Fatalf("Does not includes division by zero error. %s", compiler.Errors[0])
+		}
+	}
+}
+
+func TestCompileGuardedDivisionByZeroGlobal(t *testing.T) {
+	inputs := []string{
+		"var d = 0; var i = getn(); if (i > 0 && d != 0) { putn(10 / d); }",
+		"var d = 0; while (d != 0) { putn(10 % d); }",
+	}
+
+	for _, input := range inputs {
+		for _, level := range []OptimizationLevel{O1, O2} {
+			lexer := lexer.New("script", input)
+			parser := parser.New(lexer)
+			compiler := New(parser.ParseProgram())
+			compiler.Passes = NewPassManager(level)
+			compiler.Compile()
+
+			if compiler.HadErrors() {
+				t.Fatalf("Error occurs at level %d. %s %v", level, input, compiler.Errors)
+			}
+		}
+	}
+}
@@ -1,25 +1,25 @@
 package compiler
 
 import (
-	"hash/fnv"
-	"strings"
+	"fmt"
 
 	"github.com/simomu-github/sfflt_lang/ast"
 	"github.com/simomu-github/sfflt_lang/token"
 )
 
 const (
-	FUNCTION_LABEL = int64(0b01) << 33
-
-	VM_ADDR         = int64(0b00)
-	VM_ALLOC_REC    = int64(0b01) << 16
-	VM_CALL_STACK   = int64(0b10) << 16
-	GLOBAL_VAR_ADDR = int64(0b01) << 33
-	LOCAL_VAR_ADDR  = int64(0b10) << 33
-	HEAP_ADDR       = int64(0b11) << 33
-
-	LOCAL_VAR_SCOPE_SHIFT = 8
-	CALL_STACK_SHIFT      = 16
+	VM_ADDR          = int64(0b00)
+	VM_ALLOC_REC     = int64(0b01) << 16
+	VM_FRAME_POINTER = int64(0b10) << 16
+	VM_EXIT_CODE     = int64(0b11) << 16
+	GLOBAL_VAR_ADDR  = int64(0b01) << 18
+	LOCAL_VAR_ADDR   = int64(0b10) << 33
+	HEAP_ADDR        = int64(0b11) << 33
+
+	VM_ALLOCATED     = VM_ALLOC_REC + 1
+	VM_SIZE_CLASSES  = VM_ALLOC_REC + 2
+	HEAP_BLOCK_TABLE = int64(0b01) << 36
+	HEAP_MARK_TABLE  = int64(0b10) << 36
 )
 
 type Compiler struct {
@@ -27,39 +27,93 @@ type Compiler struct {
 	instructions      instructions
 	functions         []instructions
 	compilingFunction *compilingFunction
+	mainFrame         *frame
+	symbols           *symbolTable
 	labelIndex        int
 	breakPositions    [][]int
-}
-
-type instructions []string
+	exitLabel         int
+	allocateLabel     int
+	freeLabel         int
+	indexErrorLabel   int
+	stackTraceLabel   int
+	callSites         []callSite
+	inlineFunctions   map[string]*inlineFunction
+	// functionArities are the numbers of parameters of the functions, which
+	// asm blocks call without the arguments counted by the parser.
+	functionArities map[string]int
+	inlining          *inlining
+	sourcePos         SourcePos
+	Errors            []string
+	// DisableGC leaves freeing memory to the free build-in function.
+	DisableGC bool
+	// Checked emits runtime checks which terminate the program on errors.
+	Checked bool
+	// BranchConditions compiles comparisons and logical operations in the
+	// conditions of if and while statements into jumps.
+	BranchConditions bool
+	// InlineThreshold is the largest cost of the functions inlined at call
+	// sites. Inlining is disabled with 0.
+	InlineThreshold int
+	// Passes optimizes the statements and the instructions. No pass runs
+	// without it.
+	Passes *PassManager
+}
+
+type instructions []Instruction
 
 type compilingFunction struct {
 	ParamCount int
+	Frame      *frame
 }
 
 func New(statements []ast.Statement) *Compiler {
 	return &Compiler{
-		statements:     statements,
-		instructions:   instructions{},
-		functions:      []instructions{},
-		labelIndex:     0,
-		breakPositions: [][]int{},
+		statements:      statements,
+		mainFrame:       newFrame(frameSize(statements), 0),
+		instructions:    instructions{},
+		functions:       []instructions{},
+		symbols:         newSymbolTable(),
+		labelIndex:      0,
+		breakPositions:  [][]int{},
+		exitLabel:       noLabel,
+		allocateLabel:   noLabel,
+		freeLabel:       noLabel,
+		indexErrorLabel: noLabel,
+		stackTraceLabel: noLabel,
+		Errors:          []string{},
 	}
 }
 
-func (c *Compiler) Compile() []string {
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_ALLOC_REC))
+func (c *Compiler) Compile() []Instruction {
+	if c.Passes != nil {
+		c.statements = c.Passes.runStatements(c, c.statements)
+	}
+
+	if c.InlineThreshold > 0 {
+		c.findInlineFunctions()
+	}
+
+	c.functionArities = map[string]int{}
+	for _, stmt := range c.statements {
+		if f, ok := stmt.(ast.Function); ok {
+			c.functionArities[mangle(f.Module, f.Name.Literal)] = len(f.Params)
+		}
+	}
+
+	c.addInstructionWithArg(PUSH, VM_ALLOC_REC)
 	initHeapAddr := HEAP_ADDR + 0
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(initHeapAddr))
+	c.addInstructionWithArg(PUSH, initHeapAddr)
 	c.addInstruction(STORE)
 
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_CALL_STACK))
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(0))
+	c.addInstructionWithArg(PUSH, VM_FRAME_POINTER)
+	c.addInstructionWithArg(PUSH, LOCAL_VAR_ADDR)
 	c.addInstruction(STORE)
 
 	for _, e := range c.statements {
 		e.Visit(c)
 	}
+	c.confirmFrameSize()
+	c.sourcePos = SourcePos{}
 
 	c.addInstruction(END)
 
@@ -69,75 +123,133 @@ func (c *Compiler) Compile() []string {
 		}
 	}
 
+	if c.exitLabel != noLabel {
+		c.addInstructionWithLabel(LABEL, c.exitLabel)
+		c.addInstruction(END)
+	}
+
+	if c.allocateLabel != noLabel || c.freeLabel != noLabel {
+		c.allocatorRoutines()
+	}
+
+	if c.indexErrorLabel != noLabel {
+		c.indexErrorRoutine()
+	}
+
+	if c.stackTraceLabel != noLabel {
+		c.stackTraceRoutine()
+	}
+
+	if c.Passes != nil {
+		c.instructions = c.Passes.runInstructions(c, c.instructions)
+	}
+
 	return c.instructions
 }
 
+func (c *Compiler) HadErrors() bool {
+	return len(c.Errors) != 0
+}
+
+func (c *Compiler) compileError(tok token.Token, message string) {
+	c.Errors = append(
+		c.Errors,
+		fmt.Sprintf("%s:%d Error at '%s': %s\n", tok.Filename, tok.Line, tok.Literal, message),
+	)
+}
+
 func (c *Compiler) VisitVar(s ast.Var) {
-	if s.IsLocal {
-		c.pushLocalVariableAddress(s.ScopeDepth, s.LocalIndex)
+	defer c.at(s.Identifier)()
 
-		s.Expression.Visit(c)
-		c.addInstruction(STORE)
+	if s.IsLocal {
+		c.pushLocalVariableAddress(c.localSlot(s.Slot))
 	} else {
-		hash := hashString(s.Identifier.Literal)
-		addr := intToBinary(GLOBAL_VAR_ADDR + hash)
-		c.addInstructionWithParam(PUSH, POSI+addr)
-		s.Expression.Visit(c)
-		c.addInstruction(STORE)
+		addr := c.globalAddress(s.Identifier, s.Module)
+		c.addInstructionWithArg(PUSH, addr)
 	}
+
+	c.hold(1)
+	s.Expression.Visit(c)
+	c.release(1)
+	c.addInstruction(STORE)
 }
 
 func (c *Compiler) VisitFunction(s ast.Function) {
-	c.compilingFunction = &compilingFunction{ParamCount: len(s.Params)}
+	defer c.at(s.Name)()
+
+	f := newFrame(frameSize(s.Body), len(s.Params))
+	if inlined, ok := c.inlineFunctions[mangle(s.Module, s.Name.Literal)]; ok {
+		f.locals += c.inlineLocals(inlined)
+	}
+	c.compilingFunction = &compilingFunction{
+		ParamCount: len(s.Params),
+		Frame:      f,
+	}
 	c.functions = append(c.functions, instructions{})
 
-	hash := hashString(s.Name.Literal)
-	label := intToBinary(FUNCTION_LABEL + hash)
+	label := c.functionLabel(s.Name.Literal, s.Module)
 
-	c.addInstructionWithParam(LABEL, label)
+	c.addInstructionWithLabel(LABEL, label)
 
 	for _, stmt := range s.Body {
 		stmt.Visit(c)
 	}
-	c.addInstructionWithParam(PUSH, ZERO)
-	if len(s.Params) != 0 {
-		slideLength := intToBinary(int64(len(s.Params)))
-		c.addInstructionWithParam(SLIDE, POSI+slideLength)
-	}
+	c.addInstructionWithArg(PUSH, 0)
+	c.slideParams(len(s.Params))
 	c.addInstruction(ENDSUB)
+	c.confirmFrameSize()
 
 	c.compilingFunction = nil
 }
 
 func (c *Compiler) VisitReturn(s ast.Return) {
+	defer c.at(s.Token)()
+
+	if call, ok := s.Value.(ast.Call); ok && c.inlining == nil && c.tailCall(call) {
+		return
+	}
+
 	if s.Value == nil {
-		c.addInstructionWithParam(PUSH, ZERO)
+		c.addInstructionWithArg(PUSH, 0)
 	} else {
 		s.Value.Visit(c)
 	}
 
-	if c.compilingFunction.ParamCount != 0 {
-		slideLength := intToBinary(int64(c.compilingFunction.ParamCount))
-		c.addInstructionWithParam(SLIDE, POSI+slideLength)
+	c.slideParams(c.paramCount())
+	if c.inlining != nil {
+		pos := c.reserveJumpLabel(JUMP)
+		c.inlining.returnPositions = append(c.inlining.returnPositions, pos)
+		return
 	}
 	c.addInstruction(ENDSUB)
 }
 
+// slideParams drops the parameters below the return value.
+func (c *Compiler) slideParams(count int) {
+	if count != 0 {
+		c.addInstructionWithArg(SLIDE, int64(count))
+	}
+}
+
 func (c *Compiler) VisitBreak(s ast.Break) {
+	defer c.at(s.Token)()
+
 	pos := c.reserveJumpLabel(JUMP)
 	c.breakPositions[len(c.breakPositions)-1] = append(c.breakPositions[len(c.breakPositions)-1], pos)
 }
 
 func (c *Compiler) VisitIf(s ast.If) {
-	s.Condition.Visit(c)
+	defer c.at(expressionToken(s.Condition))()
 
-	trueJumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	falseJumpPositions := c.condition(s.Condition)
 
 	s.Then.Visit(c)
 	endJumpPos := c.reserveJumpLabel(JUMP)
 
-	trueLabel := c.markJumpLabel()
-	c.confirmJumpLabel(trueJumpPos, trueLabel)
+	falseLabel := c.markJumpLabel()
+	for _, pos := range falseJumpPositions {
+		c.confirmJumpLabel(pos, falseLabel)
+	}
 	if s.Else != nil {
 		s.Else.Visit(c)
 	}
@@ -147,11 +259,12 @@ func (c *Compiler) VisitIf(s ast.If) {
 }
 
 func (c *Compiler) VisitWhile(s ast.While) {
+	defer c.at(expressionToken(s.Condition))()
+
 	c.beginLoop()
 
 	trueJumpLabel := c.markJumpLabel()
-	s.Condition.Visit(c)
-	endJumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	endJumpPositions := c.condition(s.Condition)
 
 	s.Body.Visit(c)
 
@@ -159,7 +272,9 @@ func (c *Compiler) VisitWhile(s ast.While) {
 	c.confirmJumpLabel(trueJumpPos, trueJumpLabel)
 
 	endLabel := c.markJumpLabel()
-	c.confirmJumpLabel(endJumpPos, endLabel)
+	for _, pos := range endJumpPositions {
+		c.confirmJumpLabel(pos, endLabel)
+	}
 	breakPositions := c.currentLoopBreakPositions()
 	for _, pos := range breakPositions {
 		c.confirmJumpLabel(pos, endLabel)
@@ -175,37 +290,79 @@ func (c *Compiler) VisitBlock(s ast.Block) {
 }
 
 func (c *Compiler) VisitExpression(s ast.ExpressionStatement) {
+	defer c.at(expressionToken(s.Expression))()
+
 	s.Expression.Visit(c)
 	c.addInstruction(DISCARD)
 }
 
+func (c *Compiler) VisitAssert(s ast.Assert) {
+	defer c.at(s.Token)()
+
+	s.Condition.Visit(c)
+	failJumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	endJumpPos := c.reserveJumpLabel(JUMP)
+
+	failLabel := c.markJumpLabel()
+	c.confirmJumpLabel(failJumpPos, failLabel)
+
+	message := fmt.Sprintf("%s:%d: assertion failed", s.Token.Filename, s.Token.Line)
+	if s.Message != "" {
+		message += ": " + s.Message
+	}
+	c.putString(message + "\n")
+	if c.Checked {
+		c.callStackTrace()
+	}
+
+	c.addInstructionWithArg(PUSH, 1)
+	c.exit()
+
+	endLabel := c.markJumpLabel()
+	c.confirmJumpLabel(endJumpPos, endLabel)
+}
+
+func (c *Compiler) VisitAsmStatement(s ast.AsmStatement) {
+	c.asm(s.Asm)
+	c.release(s.Asm.In)
+	c.hold(s.Asm.Out)
+}
+
 func (c *Compiler) VisitAssign(s ast.Assign) {
+	defer c.at(expressionToken(s))()
+
 	s.Target.VisitAssign(c)
 	c.addInstruction(DUP)
+	c.hold(2)
 	s.Expression.Visit(c)
+	c.release(2)
 	c.addInstruction(STORE)
 	c.addInstruction(RETRIEVE)
 }
 
 func (c *Compiler) VisitAssignToVariable(v ast.Variable) {
 	if v.Type == ast.LOCAL {
-		c.pushLocalVariableAddress(v.ScopeDepth, v.LocalIndex)
+		c.pushLocalVariableAddress(c.localSlot(v.Slot))
 	} else {
-		hash := hashString(v.Identifier.Literal)
-		addr := intToBinary(GLOBAL_VAR_ADDR + hash)
-		c.addInstructionWithParam(PUSH, POSI+addr)
+		addr := c.globalAddress(v.Identifier, v.Module)
+		c.addInstructionWithArg(PUSH, addr)
 	}
 }
 
 func (c *Compiler) VisitAssignToIndex(i ast.Index) {
 	i.Receiver.Visit(c)
+	c.hold(1)
 	i.Index.Visit(c)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(int64(2)))
+	c.release(1)
+	c.boundsCheck(i.Token)
+	c.addInstructionWithArg(PUSH, int64(2))
 	c.addInstruction(ADD)
 	c.addInstruction(ADD)
 }
 
 func (c *Compiler) VisitBinaryExpression(e ast.Binary) {
+	defer c.at(e.Operator)()
+
 	e.Left.Visit(c)
 	var instruction InstructionType
 	switch e.Operator.Type {
@@ -217,14 +374,20 @@ func (c *Compiler) VisitBinaryExpression(e ast.Binary) {
 		instruction = MUL
 	case token.SLASH:
 		instruction = DIV
+		c.constantDivisor(e)
 	case token.MOD:
 		instruction = MOD
+		c.constantDivisor(e)
 	case token.LT, token.LTEQ, token.GT, token.GTEQ:
+		c.hold(1)
 		e.Right.Visit(c)
+		c.release(1)
 		c.comparison(e)
 		return
 	case token.EQ, token.NOT_EQ:
+		c.hold(1)
 		e.Right.Visit(c)
+		c.release(1)
 		c.equality(e)
 		return
 	case token.AND:
@@ -235,7 +398,12 @@ func (c *Compiler) VisitBinaryExpression(e ast.Binary) {
 		return
 	}
 
+	c.hold(1)
 	e.Right.Visit(c)
+	c.release(1)
+	if instruction == DIV || instruction == MOD {
+		c.divisionCheck(e.Operator)
+	}
 	c.addInstruction(instruction)
 }
 
@@ -245,9 +413,9 @@ func (c *Compiler) equality(e ast.Binary) {
 	zeroJumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
 
 	if e.Operator.Type == token.EQ {
-		c.addInstructionWithParam(PUSH, ZERO)
+		c.addInstructionWithArg(PUSH, 0)
 	} else {
-		c.addInstructionWithParam(PUSH, ONE)
+		c.addInstructionWithArg(PUSH, 1)
 	}
 	endJumpPos := c.reserveJumpLabel(JUMP)
 
@@ -255,9 +423,9 @@ func (c *Compiler) equality(e ast.Binary) {
 	c.confirmJumpLabel(zeroJumpPos, zeroLabel)
 
 	if e.Operator.Type == token.EQ {
-		c.addInstructionWithParam(PUSH, ONE)
+		c.addInstructionWithArg(PUSH, 1)
 	} else {
-		c.addInstructionWithParam(PUSH, ZERO)
+		c.addInstructionWithArg(PUSH, 0)
 	}
 
 	endLabel := c.markJumpLabel()
@@ -281,7 +449,7 @@ func (c *Compiler) comparison(e ast.Binary) {
 
 	negativeJumpOffset := c.reserveJumpLabel(JUMP_WHEN_NEGA)
 
-	c.addInstructionWithParam(PUSH, ZERO)
+	c.addInstructionWithArg(PUSH, 0)
 	endJumpOffset := c.reserveJumpLabel(JUMP)
 
 	if zeroJumpPos >= 0 {
@@ -292,7 +460,7 @@ func (c *Compiler) comparison(e ast.Binary) {
 
 	trueLabel := c.markJumpLabel()
 	c.confirmJumpLabel(negativeJumpOffset, trueLabel)
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 
 	endLabel := c.markJumpLabel()
 	c.confirmJumpLabel(endJumpOffset, endLabel)
@@ -305,13 +473,13 @@ func (c *Compiler) and(e ast.Binary) {
 
 	rhsJumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
 
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	endJumpPos := c.reserveJumpLabel(JUMP)
 
 	zeroLabel := c.markJumpLabel()
 	c.confirmJumpLabel(lhsJumpPos, zeroLabel)
 	c.confirmJumpLabel(rhsJumpPos, zeroLabel)
-	c.addInstructionWithParam(PUSH, ZERO)
+	c.addInstructionWithArg(PUSH, 0)
 
 	endLabel := c.markJumpLabel()
 	c.confirmJumpLabel(endJumpPos, endLabel)
@@ -319,7 +487,7 @@ func (c *Compiler) and(e ast.Binary) {
 
 func (c *Compiler) or(e ast.Binary) {
 	lhsJumpZeroPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	lhsJumpEndPos := c.reserveJumpLabel(JUMP)
 
 	lhsJumpZeroLabel := c.markJumpLabel()
@@ -327,13 +495,13 @@ func (c *Compiler) or(e ast.Binary) {
 	e.Right.Visit(c)
 
 	rhsJumpZeroPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	rhsJumpEndPos := c.reserveJumpLabel(JUMP)
 
 	rhsJumpZeroLabel := c.markJumpLabel()
 	c.confirmJumpLabel(rhsJumpZeroPos, rhsJumpZeroLabel)
 
-	c.addInstructionWithParam(PUSH, ZERO)
+	c.addInstructionWithArg(PUSH, 0)
 
 	endLabel := c.markJumpLabel()
 	c.confirmJumpLabel(lhsJumpEndPos, endLabel)
@@ -341,9 +509,13 @@ func (c *Compiler) or(e ast.Binary) {
 }
 
 func (c *Compiler) VisitUnaryExpression(e ast.Unary) {
+	defer c.at(e.Operator)()
+
 	if e.Operator.Type == token.MINUS {
-		c.addInstructionWithParam(PUSH, MINUS_ONE)
+		c.addInstructionWithArg(PUSH, -1)
+		c.hold(1)
 		e.Right.Visit(c)
+		c.release(1)
 		c.addInstruction(MUL)
 		return
 	}
@@ -352,13 +524,13 @@ func (c *Compiler) VisitUnaryExpression(e ast.Unary) {
 		e.Right.Visit(c)
 		zeroJumpPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
 
-		c.addInstructionWithParam(PUSH, ZERO)
+		c.addInstructionWithArg(PUSH, 0)
 		endJumpPos := c.reserveJumpLabel(JUMP)
 
 		zeroLabel := c.markJumpLabel()
 		c.confirmJumpLabel(zeroJumpPos, zeroLabel)
 
-		c.addInstructionWithParam(PUSH, ONE)
+		c.addInstructionWithArg(PUSH, 1)
 
 		endLabel := c.markJumpLabel()
 		c.confirmJumpLabel(endJumpPos, endLabel)
@@ -369,71 +541,82 @@ func (c *Compiler) VisitUnaryExpression(e ast.Unary) {
 }
 
 func (c *Compiler) VisitCall(e ast.Call) {
+	defer c.at(e.Callee)()
+
 	for _, arg := range e.Arguments {
 		arg.Visit(c)
+		c.hold(1)
 	}
-	if b, ok := buildinFunctions[e.Callee.Literal]; ok {
+	c.release(len(e.Arguments))
+
+	if b, ok := lookupBuildinFunction(e); ok {
 		b.f(c)
+	} else if f, ok := c.lookupInlineFunction(e); ok {
+		c.inline(f)
 	} else {
-		hash := hashString(e.Callee.Literal)
-		label := intToBinary(FUNCTION_LABEL + hash)
+		label := c.functionLabel(e.Callee.Literal, e.Module)
 
+		c.spillStack(len(e.Arguments))
+		c.pushCallSite(e)
 		c.beforeCall()
-		c.addInstructionWithParam(CALLSUB, label)
+		c.addInstructionWithLabel(CALLSUB, label)
 		c.afterCall()
+		c.popCallSite()
 	}
 }
 
 func (c *Compiler) VisitIntegerLiteral(e ast.IntegerLiteral) {
-	value := intToBinary(e.Value)
-	var sign string
-	if e.Value >= 0 {
-		sign = POSI
-	} else {
-		sign = NEGA
-	}
-	c.addInstructionWithParam(PUSH, sign+value)
+	defer c.at(e.Token)()
+
+	c.addInstructionWithArg(PUSH, e.Value)
 }
 
 func (c *Compiler) VisitCharLiteral(e ast.CharLiteral) {
-	value := intToBinary(int64([]rune(e.Value)[0]))
-	c.addInstructionWithParam(PUSH, POSI+value)
+	defer c.at(e.Token)()
+
+	c.addInstructionWithArg(PUSH, int64([]rune(e.Value)[0]))
 }
 
 func (c *Compiler) VisitStringLiteral(e ast.StringLiteral) {
+	defer c.at(e.Token)()
+
 	length := int64(len(e.Token.Literal))
 	capacity := length * 2
 
 	c.allocate(capacity + 2)
 
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(length))
+	c.addInstructionWithArg(PUSH, length)
 	c.addInstruction(STORE)
 
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(capacity))
+	c.addInstructionWithArg(PUSH, capacity)
 	c.addInstruction(STORE)
 
 	for i, char := range e.Token.Literal {
 		c.addInstruction(DUP)
-		c.addInstructionWithParam(PUSH, POSI+intToBinary(int64(i+2)))
+		c.addInstructionWithArg(PUSH, int64(i+2))
 		c.addInstruction(ADD)
-		c.addInstructionWithParam(PUSH, POSI+intToBinary(int64(char)))
+		c.addInstructionWithArg(PUSH, int64(char))
 		c.addInstruction(STORE)
 	}
 }
 
 func (c *Compiler) VisitBooleanLiteral(e ast.BooleanLiteral) {
+	defer c.at(e.Token)()
+
 	if e.Value {
-		c.addInstructionWithParam(PUSH, ONE)
+		c.addInstructionWithArg(PUSH, 1)
 	} else {
-		c.addInstructionWithParam(PUSH, ZERO)
+		c.addInstructionWithArg(PUSH, 0)
 	}
 }
 
 func (c *Compiler) VisitVariable(e ast.Variable) {
+	defer c.at(e.Identifier)()
+
 	if e.Type == ast.ARGUMENT {
 		c.argumentVariable(e)
 	} else if e.Type == ast.LOCAL {
@@ -444,94 +627,125 @@ func (c *Compiler) VisitVariable(e ast.Variable) {
 }
 
 func (c *Compiler) argumentVariable(e ast.Variable) {
-	offset := c.compilingFunction.ParamCount - e.ArgumentIndex + e.RelativeIndex
-	param := intToBinary(int64(offset))
-	c.addInstructionWithParam(COPY, POSI+param)
+	offset := c.paramCount() - e.ArgumentIndex + e.RelativeIndex
+	c.addInstructionWithArg(COPY, int64(offset))
 }
 
 func (c *Compiler) globalVariable(e ast.Variable) {
-	hash := hashString(e.Identifier.Literal)
-	addr := intToBinary(GLOBAL_VAR_ADDR + hash)
-	c.addInstructionWithParam(PUSH, POSI+addr)
+	addr := c.globalAddress(e.Identifier, e.Module)
+	c.addInstructionWithArg(PUSH, addr)
 	c.addInstruction(RETRIEVE)
 }
 
 func (c *Compiler) localVariable(e ast.Variable) {
-	c.pushLocalVariableAddress(e.ScopeDepth, e.LocalIndex)
+	c.pushLocalVariableAddress(c.localSlot(e.Slot))
 	c.addInstruction(RETRIEVE)
 }
 
 func (c *Compiler) VisitArrayLiteral(e ast.ArrayLiteral) {
+	defer c.at(e.Token)()
+
 	length := int64(len(e.Elements))
 	capacity := length * 2
 
 	c.allocate(capacity + 2)
 
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(length))
+	c.addInstructionWithArg(PUSH, length)
 	c.addInstruction(STORE)
 
 	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, ONE)
+	c.addInstructionWithArg(PUSH, 1)
 	c.addInstruction(ADD)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(capacity))
+	c.addInstructionWithArg(PUSH, capacity)
 	c.addInstruction(STORE)
 
 	for i, element := range e.Elements {
 		c.addInstruction(DUP)
-		c.addInstructionWithParam(PUSH, POSI+intToBinary(int64(i+2)))
+		c.addInstructionWithArg(PUSH, int64(i+2))
 		c.addInstruction(ADD)
+		c.hold(2)
 		element.Visit(c)
+		c.release(2)
 		c.addInstruction(STORE)
 	}
 }
 
 func (c *Compiler) VisitIndex(e ast.Index) {
+	defer c.at(e.Token)()
+
 	e.Receiver.Visit(c)
+	c.hold(1)
 	e.Index.Visit(c)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(int64(2)))
+	c.release(1)
+	c.boundsCheck(e.Token)
+	c.addInstructionWithArg(PUSH, int64(2))
 	c.addInstruction(ADD)
 	c.addInstruction(ADD)
 	c.addInstruction(RETRIEVE)
 }
 
+func (c *Compiler) VisitAsm(e ast.Asm) {
+	c.asm(e)
+	c.release(e.In)
+}
+
 func (c *Compiler) addInstruction(instruction InstructionType) {
-	if c.isCompilingFunction() {
-		idx := len(c.functions) - 1
-		c.functions[idx] = append(c.functions[idx], string(instruction))
-	} else {
-		c.instructions = append(c.instructions, string(instruction))
-	}
+	c.emit(Instruction{Op: instruction})
 }
 
-func (c *Compiler) addInstructionWithParam(instruction InstructionType, param string) {
+func (c *Compiler) addInstructionWithArg(instruction InstructionType, arg int64) {
+	c.emit(Instruction{Op: instruction, Arg: arg})
+}
+
+func (c *Compiler) addInstructionWithLabel(instruction InstructionType, label int) {
+	c.emit(Instruction{Op: instruction, Label: label})
+}
+
+// at sets the source position of the instructions added until the returned
+// function restores the enclosing one.
+func (c *Compiler) at(tok token.Token) func() {
+	enclosing := c.sourcePos
+	c.sourcePos = SourcePos{Filename: tok.Filename, Line: tok.Line, Column: tok.Column}
+	return func() { c.sourcePos = enclosing }
+}
+
+func (c *Compiler) emit(instruction Instruction) {
+	instruction.SourcePos = c.sourcePos
 	if c.isCompilingFunction() {
 		idx := len(c.functions) - 1
-		c.functions[idx] = append(c.functions[idx], string(instruction)+param+"T")
+		c.functions[idx] = append(c.functions[idx], instruction)
 	} else {
-		c.instructions = append(c.instructions, string(instruction)+param+"T")
+		c.instructions = append(c.instructions, instruction)
 	}
 }
 
+// reserveJumpLabel adds a jump whose label is set by confirmJumpLabel, and
+// returns its position.
 func (c *Compiler) reserveJumpLabel(instruction InstructionType) int {
-	c.addInstructionWithParam(instruction, "?")
+	c.addInstructionWithLabel(instruction, noLabel)
 	return len(c.currentInstructions()) - 1
 }
 
-func (c *Compiler) markJumpLabel() string {
-	label := intToBinary(int64(c.labelIndex))
-	c.labelIndex++
+func (c *Compiler) markJumpLabel() int {
+	label := c.newLabel()
+	c.addInstructionWithLabel(LABEL, label)
 
-	c.addInstructionWithParam(LABEL, label)
+	return label
+}
+
+func (c *Compiler) newLabel() int {
+	label := c.labelIndex
+	c.labelIndex++
 
 	return label
 }
 
-func (c *Compiler) confirmJumpLabel(pos int, label string) {
-	c.currentInstructions()[pos] = strings.Replace(c.currentInstructions()[pos], "?", label, 1)
+func (c *Compiler) confirmJumpLabel(pos int, label int) {
+	c.currentInstructions()[pos].Label = label
 }
 
-func (c *Compiler) currentInstructions() []string {
+func (c *Compiler) currentInstructions() []Instruction {
 	if !c.isCompilingFunction() {
 		return c.instructions
 	}
@@ -557,74 +771,110 @@ func (c *Compiler) endLoop() {
 }
 
 func (c *Compiler) allocate(size int64) {
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_ALLOC_REC))
-	c.addInstruction(RETRIEVE)
-	c.addInstruction(DUP)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(size))
-	c.addInstruction(ADD)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_ALLOC_REC))
+	c.addInstructionWithArg(PUSH, size)
+	c.callAllocate()
+}
+
+func (c *Compiler) putString(str string) {
+	for _, char := range str {
+		c.addInstructionWithArg(PUSH, int64(char))
+		c.addInstruction(PUTC)
+	}
+}
+
+// exit stores the exit code on the top of the stack and jumps to the shared
+// termination label emitted after all functions.
+func (c *Compiler) exit() {
+	c.addInstructionWithArg(PUSH, VM_EXIT_CODE)
 	c.addInstruction(SWAP)
 	c.addInstruction(STORE)
+	if c.exitLabel == noLabel {
+		c.exitLabel = c.newLabel()
+	}
+	c.addInstructionWithLabel(JUMP, c.exitLabel)
 }
 
-func (c *Compiler) pushLocalVariableAddress(scopeDepth, localIndex int) {
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_CALL_STACK))
+// pushLocalVariableAddress pushes the address of the local variable, which is
+// the frame pointer plus the slot of the variable.
+func (c *Compiler) pushLocalVariableAddress(slot int) {
+	c.addInstructionWithArg(PUSH, VM_FRAME_POINTER)
 	c.addInstruction(RETRIEVE)
-	callStackAddr := intToBinary(1 << CALL_STACK_SHIFT)
-	c.addInstructionWithParam(PUSH, POSI+callStackAddr)
-	c.addInstruction(MUL)
 
-	addr := intToBinary(LOCAL_VAR_ADDR + int64(scopeDepth<<LOCAL_VAR_SCOPE_SHIFT) + int64(localIndex))
-	c.addInstructionWithParam(PUSH, POSI+addr)
-	c.addInstruction(ADD)
+	if slot != 0 {
+		c.addInstructionWithArg(PUSH, int64(slot))
+		c.addInstruction(ADD)
+	}
 }
 
+// beforeCall moves the frame pointer over the frame of the caller.
+// Without the collector, callers without local variables share the frame
+// pointer with the callee.
 func (c *Compiler) beforeCall() {
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_CALL_STACK))
-	c.addInstruction(RETRIEVE)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(1))
-	c.addInstruction(ADD)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_CALL_STACK))
-	c.addInstruction(SWAP)
-	c.addInstruction(STORE)
+	c.moveFramePointer(ADD)
 }
 
 func (c *Compiler) afterCall() {
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_CALL_STACK))
+	c.moveFramePointer(SUB)
+}
+
+func (c *Compiler) moveFramePointer(instruction InstructionType) {
+	if c.DisableGC && c.currentFrame().locals == 0 {
+		return
+	}
+
+	c.addInstructionWithArg(PUSH, VM_FRAME_POINTER)
+	c.addInstruction(DUP)
 	c.addInstruction(RETRIEVE)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(1))
-	c.addInstruction(SUB)
-	c.addInstructionWithParam(PUSH, POSI+intToBinary(VM_CALL_STACK))
-	c.addInstruction(SWAP)
+	c.pushFrameSize()
+	c.addInstruction(instruction)
 	c.addInstruction(STORE)
 }
 
-func intToBinary(value int64) string {
-	binary := []string{}
+func (c *Compiler) currentFrame() *frame {
+	if c.isCompilingFunction() {
+		return c.compilingFunction.Frame
+	}
 
-	decimal := value
-	for {
-		bin := decimal % 2
-		if bin == 0 {
-			binary = append(binary, "F")
-		} else {
-			binary = append(binary, "L")
-		}
-		decimal /= 2
+	return c.mainFrame
+}
 
-		if decimal == 0 {
-			break
-		}
+// pushFrameSize pushes the size of the current frame. The spill slots are
+// counted only after the whole frame is compiled, so the size is patched by
+// confirmFrameSize when the collector is enabled.
+func (c *Compiler) pushFrameSize() {
+	f := c.currentFrame()
+	if c.DisableGC {
+		c.addInstructionWithArg(PUSH, int64(f.locals))
+		return
 	}
 
-	for i := 0; i < len(binary)/2; i++ {
-		binary[i], binary[len(binary)-i-1] = binary[len(binary)-i-1], binary[i]
+	c.addInstructionWithArg(PUSH, 0)
+	f.sizePositions = append(f.sizePositions, len(c.currentInstructions())-1)
+}
+
+func (c *Compiler) confirmFrameSize() {
+	f := c.currentFrame()
+	for _, pos := range f.sizePositions {
+		c.currentInstructions()[pos].Arg = int64(f.locals + f.spills)
 	}
-	return strings.Join(binary, "")
 }
 
-func hashString(str string) int64 {
-	h := fnv.New32a()
-	h.Write([]byte(str))
-	return int64(h.Sum32())
+// hold records that n values stay on the operand stack while the following
+// expression is compiled.
+func (c *Compiler) hold(n int) {
+	c.currentFrame().stack += n
+}
+
+func (c *Compiler) release(n int) {
+	c.currentFrame().stack -= n
+}
+
+// mangle qualifies a function or global variable name with its module so that
+// each imported module has its own namespace.
+func mangle(module string, name string) string {
+	if module == "" {
+		return name
+	}
+
+	return module + "." + name
 }
@@ -1,6 +1,8 @@
 package compiler
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/simomu-github/sfflt_lang/lexer"
@@ -26,17 +28,11 @@ func TestCompilePrimary(t *testing.T) {
 
 func TestCompileArrayLiteral(t *testing.T) {
 	input := "[1, 2];"
-	instructions := compile(input, t)
+	instructions := compileWithoutGC(input, t)
 	expects := []string{
 		// allocate 6
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"LLL",                   // retrieve
-		"FTF",                   // dup
-		"FFFLLFT",               // push 6 ( length * 2 + 2 )
-		"LFFF",                  // add
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"FTL",                   // swap
-		"LLF",                   // store
+		"FFFLLFT", // push 6 ( length * 2 + 2 )
+		"TFLFT",   // call allocate
 
 		// setup array
 		"FTF",     // dup
@@ -68,17 +64,11 @@ func TestCompileArrayLiteral(t *testing.T) {
 
 func TestCompileStringLiteral(t *testing.T) {
 	input := "\"abc\";"
-	instructions := compile(input, t)
+	instructions := compileWithoutGC(input, t)
 	expects := []string{
 		// allocate 8
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"LLL",                   // retrieve
-		"FTF",                   // dup
-		"FFFLFFFT",              // push 8 ( length * 2 + 2 )
-		"LFFF",                  // add
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"FTL",                   // swap
-		"LLF",                   // store
+		"FFFLFFFT", // push 8 ( length * 2 + 2 )
+		"TFLFT",    // call allocate
 
 		// setup string
 		"FTF",     // dup
@@ -134,32 +124,14 @@ func TestCompileBang(t *testing.T) {
 
 func TestCompileCall(t *testing.T) {
 	input := "a(1, 2, 3);"
-	instructions := compile(input, t)
+	instructions := compileWithoutGC(input, t)
 	expects := []string{
 		// arguments
 		"FFFLT",  // push 1
 		"FFFLFT", // push 2
 		"FFFLLT", // push 3
 
-		// before call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
-		"LFFF",                   // add
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
-		"LLF",                    // store
-
-		"TFLLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // call sub
-
-		// after call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
-		"LFFL",                   // sub
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
-		"LLF",                    // store
+		"TFLFT", // call sub
 	}
 
 	assertInstructions(instructions, expects, t)
@@ -167,17 +139,11 @@ func TestCompileCall(t *testing.T) {
 
 func TestCompileIndex(t *testing.T) {
 	input := "[1][0];"
-	instructions := compile(input, t)
+	instructions := compileWithoutGC(input, t)
 	expects := []string{
 		// allocate 4
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"LLL",                   // retrieve
-		"FTF",                   // dup
-		"FFFLFFT",               // push 4 ( length * 2 + 2 )
-		"LFFF",                  // add
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"FTL",                   // swap
-		"LLF",                   // store
+		"FFFLFFT", // push 4 ( length * 2 + 2 )
+		"TFLFT",   // call allocate
 
 		// setup array
 		"FTF",    // dup
@@ -364,14 +330,14 @@ func TestCompileGlobalVariableAssign(t *testing.T) {
 	input := "var a = 1; a = 2;"
 	instructions := compile(input, t)
 	expects := []string{
-		"FFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // push "a" address
-		"FFFLT",                                  // push 1
-		"LLF",                                    // store
+		"FFFLFFFFFFFFFFFFFFFFFFT", // push "a" address
+		"FFFLT",                   // push 1
+		"LLF",                     // store
 
-		"FFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // push "a" address
-		"FTF",                                    // dup
-		"FFFLFT",                                 // push 2
-		"LLF",                                    // store
+		"FFFLFFFFFFFFFFFFFFFFFFT", // push "a" address
+		"FTF",                     // dup
+		"FFFLFT",                  // push 2
+		"LLF",                     // store
 
 		"LLL", // retrieve
 		"FTT", // discard
@@ -384,28 +350,16 @@ func TestCompileAssignLocalVariable(t *testing.T) {
 	input := "{ var a = 1; a = 2; }"
 	instructions := compile(input, t)
 	expects := []string{
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-
 		// calculate local variable address
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFT", // push local variable addr (scope 1, index 0)
-		"LFFF", // add
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
 
 		"FFFLT", // push 1
 		"LLF",   // store
 
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-
 		// calculate local variable address
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFT", // push local variable addr (scope 1, index 0)
-		"LFFF", // add
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
 
 		"FTF",    // dup
 		"FFFLFT", // push 2
@@ -420,18 +374,12 @@ func TestCompileAssignLocalVariable(t *testing.T) {
 
 func TestCompileAssignIndex(t *testing.T) {
 	input := "[1][0] = 2;"
-	instructions := compile(input, t)
+	instructions := compileWithoutGC(input, t)
 	expects := []string{
 		// array literal
 		// allocate 4
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"LLL",                   // retrieve
-		"FTF",                   // dup
-		"FFFLFFT",               // push 4 ( length * 2 + 2 )
-		"LFFF",                  // add
-		"FFFLFFFFFFFFFFFFFFFFT", // push last heap allocate address
-		"FTL",                   // swap
-		"LLF",                   // store
+		"FFFLFFT", // push 4 ( length * 2 + 2 )
+		"TFLFT",   // call allocate
 
 		// setup array
 		"FTF",    // dup
@@ -505,10 +453,10 @@ func TestCompileGlobalVariable(t *testing.T) {
 	input := "var a = 1; a;"
 	instructions := compile(input, t)
 	expects := []string{
-		"FFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT",
+		"FFFLFFFFFFFFFFFFFFFFFFT",
 		"FFFLT",
 		"LLF",
-		"FFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT",
+		"FFFLFFFFFFFFFFFFFFFFFFT",
 		"LLL",
 		"FTT",
 	}
@@ -516,12 +464,33 @@ func TestCompileGlobalVariable(t *testing.T) {
 	assertInstructions(instructions, expects, t)
 }
 
+func TestCompileGlobalVariableAddress(t *testing.T) {
+	input := "var a = 1; var b = 2; b; a;"
+	instructions := compile(input, t)
+	expects := []string{
+		"FFFLFFFFFFFFFFFFFFFFFFT", // push a address
+		"FFFLT",                   // push 1
+		"LLF",                     // store
+		"FFFLFFFFFFFFFFFFFFFFFLT", // push b address
+		"FFFLFT",                  // push 2
+		"LLF",                     // store
+		"FFFLFFFFFFFFFFFFFFFFFLT", // push b address
+		"LLL",                     // retrieve
+		"FTT",                     // discard
+		"FFFLFFFFFFFFFFFFFFFFFFT", // push a address
+		"LLL",                     // retrieve
+		"FTT",                     // discard
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
 func TestCompileArgumentVariable(t *testing.T) {
 	input := "func f(a, b, c) { a + c; }"
 	instructions := compile(input, t)
 	expects := []string{
 		"TTT",
-		"TFFLFLLLFFFLLFFFFLLFFFFLFFLLLLFFLLFFLT",
+		"TFFFT",
 		"FLFFLFT", // copy 2
 		"FLFFLT",  // copy 1
 		"LFFF",    // add
@@ -538,62 +507,43 @@ func TestCompileLocalVariable(t *testing.T) {
 	input := "{ var a = 1; { var b = 2; var c = 3;  a; b; }}"
 	instructions := compile(input, t)
 	expects := []string{
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
+		// calculate local variable address
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
 		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-		// calculate local variable addr
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFT", // push local variable addr (scope 1, index 0)
-		"LFFF", // add
 
 		"FFFLT", // push 1
 		"LLF",   // store
 
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
+		// calculate local variable address
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
 		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-		// calculate local variable addr
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFFT", // push local variable addr (scope 2, index 0)
-		"LFFF", // add
+		"FFFLT",                  // push slot 1
+		"LFFF",                   // add
 
 		"FFFLFT", // push 2
 		"LLF",    // store
 
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
+		// calculate local variable address
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
 		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-		// calculate local variable addr
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFLT", // push local variable addr (scope 2, index 1)
-		"LFFF", // add
+		"FFFLFT",                 // push slot 2
+		"LFFF",                   // add
 
 		"FFFLLT", // push 3
 		"LLF",    // store
 
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
+		// calculate local variable address
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
 		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-		// calculate local variable addr
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFT", // push local variable addr (scope 1, index 0)
-		"LFFF", // add
 
 		"LLL", // retrieve
 		"FTT", // discard
 
-		// calculate call stack depth
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
+		// calculate local variable address
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
 		"LLL",                    // retrieve
-		"FFFLFFFFFFFFFFFFFFFFT",  // push 1 << 16 (call stack bit map)
-		"LFFT",                   // mul
-		// calculate local variable addr
-		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFLFFFFFFFFFT", // push local variable addr (scope 2, index 0)
-		"LFFF", // add
+		"FFFLT",                  // push slot 1
+		"LFFF",                   // add
 
 		"LLL", // retrieve
 		"FTT", // discard
@@ -604,36 +554,17 @@ func TestCompileLocalVariable(t *testing.T) {
 
 func TestCompileFunction(t *testing.T) {
 	input := "func a() { 1;} a();"
-	instructions := compile(input, t)
+	instructions := compileWithoutGC(input, t)
 	expects := []string{
-		// before call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
-		"LFFF",                   // add
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
-		"LLF",                    // store
-
-		"TFLLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // jump a()
-
-		// after call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
-		"LFFL",                   // sub
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
-		"LLF",                    // store
-
-		"FTT", // discard
-		"TTT", // end
+		"TFLFT", // jump a()
+		"FTT",   // discard
+		"TTT",   // end
 
-		"TFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // mark label
-		"FFFLT",                                  // push 1
-		"FTT",                                    // discard
-		"FFFFT",                                  // push 0
-		"TLT",                                    // end sub
+		"TFFFT", // mark label
+		"FFFLT", // push 1
+		"FTT",   // discard
+		"FFFFT", // push 0
+		"TLT",   // end sub
 	}
 
 	assertInstructions(instructions, expects, t)
@@ -645,36 +576,18 @@ func TestCompileReturn(t *testing.T) {
 	parser := parser.New(lexer)
 	exprs := parser.ParseProgram()
 	compiler := New(exprs)
+	compiler.DisableGC = true
 
-	instructions := compiler.Compile()
+	instructions := Encode(compiler.Compile())
 	expects := []string{
-		// before call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
-		"LFFF",                   // add
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
-		"LLF",                    // store
-
-		"TFLLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // call 1()
-
-		// after call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
-		"LFFL",                   // sub
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
-		"LLF",                    // store
-
-		"FTT",                                    // discard
-		"TTT",                                    // end
-		"TFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // mark label
-		"FFFLT",                                  // push 1
-		"TLT",                                    // end sub
-		"FFFFT",                                  // push 0
-		"TLT",                                    // end sub
+		"TFLFT", // call 1()
+		"FTT",   // discard
+		"TTT",   // end
+		"TFFFT", // mark label
+		"FFFLT", // push 1
+		"TLT",   // end sub
+		"FFFFT", // push 0
+		"TLT",   // end sub
 	}
 
 	assertInstructions(instructions, expects, t)
@@ -686,35 +599,51 @@ func TestCompileEmptyReturn(t *testing.T) {
 	parser := parser.New(lexer)
 	exprs := parser.ParseProgram()
 	compiler := New(exprs)
+	compiler.DisableGC = true
 
-	instructions := compiler.Compile()
+	instructions := Encode(compiler.Compile())
 	expects := []string{
+		"TFLFT", // call a()
+		"FTT",   // discard
+		"TTT",   // end
+		"TFFFT", // mark label
+		"FFFFT", //push 0
+		"TLT",   // end sub
+		"FFFFT", // push 0
+		"TLT",   // end sub
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileCallWithFrame(t *testing.T) {
+	input := "func a() {} { var b = 1; a(); }"
+	instructions := compile(input, t)
+	expects := []string{
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
+		"FFFLT",                  // push 1
+		"LLF",                    // store
+
 		// before call
-		"FFFLFFFFFFFFFFFFFFFFFT",                 // push call stack address
-		"LLL",                                    // retrieve
-		"FFFLT",                                  // push 1
-		"LFFF",                                   // add
-		"FFFLFFFFFFFFFFFFFFFFFT",                 // push call stack address
-		"FTL",                                    // swap
-		"LLF",                                    // store
-		"TFLLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // call a()
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"FTF",                    // dup
+		"LLL",                    // retrieve
+		"FFFLT",                  // push frame size 1
+		"LFFF",                   // add
+		"LLF",                    // store
+
+		"TFLFT", // call a()
 
 		// after call
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"FTF",                    // dup
 		"LLL",                    // retrieve
-		"FFFLT",                  // push 1
+		"FFFLT",                  // push frame size 1
 		"LFFL",                   // sub
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FTL",                    // swap
 		"LLF",                    // store
 
-		"FTT",                                    // discard
-		"TTT",                                    // end
-		"TFFLFLLLFFLFFFFFFLLFFFFLFLFFLFFLFLLFFT", // mark label
-		"FFFFT",                                  //push 0
-		"TLT",                                    // end sub
-		"FFFFT",                                  // push 0
-		"TLT",                                    // end sub
+		"FTT", // discard
 	}
 
 	assertInstructions(instructions, expects, t)
@@ -746,16 +675,119 @@ func TestCompileBreak(t *testing.T) {
 	assertInstructions(instructions, expects, t)
 }
 
+func TestCompileAssert(t *testing.T) {
+	input := `assert(false, "a");`
+	instructions := compile(input, t)
+	expects := []string{
+		"FFFFT",       // condition
+		"TLFFT",       // jump label when zero
+		"TFTLFT",      // jump label to end
+		"TFFFT",       // mark label fail
+		"FFFLLLFFLLT", // push 's'
+		"LTFF",        // putc
+	}
+
+	assertInstructions(instructions, expects, t)
+
+	message := "script:1: assertion failed: a\n"
+	offset := 6 + 4 + len(message)*2
+	rest := []string{
+		"FFFLT",                  // push 1
+		"FFFLLFFFFFFFFFFFFFFFFT", // push exit code address
+		"FTL",                    // swap
+		"LLF",                    // store
+		"TFTLT",                  // jump exit
+		"TFFLFT",                 // mark label end
+		"TTT",                    // end
+		"TFFLT",                  // mark label exit
+		"TTT",                    // end
+	}
+	for i, expect := range rest {
+		if instructions[offset+i] != expect {
+			t.Fatalf("tests[%d] - instruction wrong. expected=%q, got=%q", i, expect, instructions[offset+i])
+		}
+	}
+}
+
+func TestCompileSourcePos(t *testing.T) {
+	input := "var a = 1;\nputn(a +\n  2);"
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	exprs := parser.ParseProgram()
+	compiler := New(exprs)
+	compiler.DisableGC = true
+
+	instructions := compiler.Compile()[6:]
+	expects := []struct {
+		op   InstructionType
+		line int
+	}{
+		{PUSH, 1},     // push a
+		{PUSH, 1},     // push 1
+		{STORE, 1},    // store
+		{PUSH, 2},     // push a
+		{RETRIEVE, 2}, // retrieve
+		{PUSH, 3},     // push 2
+		{ADD, 2},      // add
+		{PUTN, 2},     // putn
+		{PUSH, 2},     // push 0
+		{DISCARD, 2},  // discard
+		{END, 0},      // end
+	}
+
+	for i, expect := range expects {
+		if instructions[i].Op != expect.op || instructions[i].SourcePos.Line != expect.line {
+			t.Fatalf("tests[%d] - instruction wrong. expected=%s at %d, got=%s at %d",
+				i, expect.op, expect.line, instructions[i].Op, instructions[i].SourcePos.Line)
+		}
+	}
+}
+
+func TestCompileAsm(t *testing.T) {
+	input := "func f(a) { asm(out: 1) { push -1; } putn(a); asm(in: 1) { label l; jz l; } }"
+	instructions := compile(input, t)
+	expects := []string{
+		"TTT",
+		"TFFFT",  // mark label f
+		"FFLLT",  // push -1
+		"FLFFLT", // copy 1 (a below the value left by asm)
+		"LTFL",   // putn
+		"FFFFT",  // push 0
+		"FTT",    // discard
+		"TFFLT",  // mark label l
+		"TLFLT",  // jump l when zero
+		"FFFFT",  // push 0
+		"FLTFLT", // slide 1
+		"TLT",    // end sub
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
 func compile(input string, t *testing.T) []string {
+	return compileWith(input, nil, t)
+}
+
+func compileWithoutGC(input string, t *testing.T) []string {
+	return compileWith(input, func(c *Compiler) { c.DisableGC = true }, t)
+}
+
+// compileWith compiles input after option sets up the compiler, and fails on
+// parse errors.
+func compileWith(input string, option func(c *Compiler), t *testing.T) []string {
 	lexer := lexer.New("script", input)
 	parser := parser.New(lexer)
+	exprs := parser.ParseProgram()
 	if parser.HadErrors() {
-		t.Fatalf("Parse error occurred.")
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
 	}
-	exprs := parser.ParseProgram()
+
 	compiler := New(exprs)
+	if option != nil {
+		option(compiler)
+	}
 
-	return compiler.Compile()
+	return Encode(compiler.Compile())
 }
 
 func assertInstructions(actuals []string, expects []string, t *testing.T) {
@@ -768,9 +800,9 @@ func assertInstructions(actuals []string, expects []string, t *testing.T) {
 		"FFFLLFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFT", // push init heap address
 		"LLF", // store
 
-		"FFFLFFFFFFFFFFFFFFFFFT", // push call stack address
-		"FFFFT",                  // push init call stack
-		"LLF",                    // store
+		"FFFLFFFFFFFFFFFFFFFFFT",                  // push frame pointer address
+		"FFFLFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFT", // push local variable address
+		"LLF", // store
 	}
 	for i, expect := range initExpects {
 		if actuals[i] != expect {
@@ -787,3 +819,100 @@ func assertInstructions(actuals []string, expects []string, t *testing.T) {
 		}
 	}
 }
+
+// execute runs instructions as the VM does and returns what they print.
+// Reading input is not supported.
+func execute(instructions []Instruction, t *testing.T) string {
+	labels := map[int]int{}
+	for i, instruction := range instructions {
+		if instruction.Op == LABEL {
+			labels[instruction.Label] = i
+		}
+	}
+
+	var out strings.Builder
+	stack := []int64{}
+	calls := []int{}
+	heap := map[int64]int64{}
+	pop := func() int64 {
+		if len(stack) == 0 {
+			t.Fatalf("stack underflow. output=%q", out.String())
+		}
+		value := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return value
+	}
+
+	for pc, steps := 0, 0; pc < len(instructions); steps++ {
+		if steps > 10000000 {
+			t.Fatalf("too many steps. output=%q", out.String())
+		}
+
+		instruction := instructions[pc]
+		pc++
+		switch instruction.Op {
+		case PUSH:
+			stack = append(stack, instruction.Arg)
+		case DUP:
+			value := pop()
+			stack = append(stack, value, value)
+		case SWAP:
+			a, b := pop(), pop()
+			stack = append(stack, a, b)
+		case DISCARD:
+			pop()
+		case COPY:
+			stack = append(stack, stack[len(stack)-1-int(instruction.Arg)])
+		case SLIDE:
+			value := pop()
+			stack = append(stack[:len(stack)-int(instruction.Arg)], value)
+		case ADD, SUB, MUL, DIV, MOD:
+			b, a := pop(), pop()
+			switch instruction.Op {
+			case ADD:
+				stack = append(stack, a+b)
+			case SUB:
+				stack = append(stack, a-b)
+			case MUL:
+				stack = append(stack, a*b)
+			case DIV:
+				stack = append(stack, a/b)
+			case MOD:
+				stack = append(stack, a%b)
+			}
+		case STORE:
+			value, address := pop(), pop()
+			heap[address] = value
+		case RETRIEVE:
+			stack = append(stack, heap[pop()])
+		case PUTC:
+			out.WriteByte(byte(pop()))
+		case PUTN:
+			fmt.Fprint(&out, pop())
+		case JUMP:
+			pc = labels[instruction.Label]
+		case JUMP_WHEN_ZERO:
+			if pop() == 0 {
+				pc = labels[instruction.Label]
+			}
+		case JUMP_WHEN_NEGA:
+			if pop() < 0 {
+				pc = labels[instruction.Label]
+			}
+		case CALLSUB:
+			calls = append(calls, pc)
+			pc = labels[instruction.Label]
+		case ENDSUB:
+			pc = calls[len(calls)-1]
+			calls = calls[:len(calls)-1]
+		case END:
+			return out.String()
+		case LABEL:
+		default:
+			t.Fatalf("unsupported instruction %s.", instruction.Op.Mnemonic())
+		}
+	}
+
+	t.Fatalf("program does not end. output=%q", out.String())
+	return ""
+}
@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/token"
+)
+
+// condition compiles the condition of an if or while statement, which falls
+// through when it holds. It returns the positions of the jumps taken when it
+// does not, which are confirmed by the caller.
+func (c *Compiler) condition(e ast.Expression) []int {
+	if !c.BranchConditions {
+		e.Visit(c)
+		return []int{c.reserveJumpLabel(JUMP_WHEN_ZERO)}
+	}
+
+	return c.branch(e, false)
+}
+
+// branch compiles e into jumps taken when its truth equals when, instead of
+// pushing 0 or 1 and testing it. It falls through otherwise.
+func (c *Compiler) branch(e ast.Expression, when bool) []int {
+	if value, ok := constantValue(e); ok {
+		if (value != 0) == when {
+			return []int{c.reserveJumpLabel(JUMP)}
+		}
+		return []int{}
+	}
+
+	switch e := e.(type) {
+	case ast.Unary:
+		if e.Operator.Type == token.BANG {
+			return c.branch(e.Right, !when)
+		}
+	case ast.Binary:
+		switch e.Operator.Type {
+		case token.AND:
+			return c.branchLogical(e, false, when)
+		case token.OR:
+			return c.branchLogical(e, true, when)
+		case token.LT, token.LTEQ, token.GT, token.GTEQ, token.EQ, token.NOT_EQ:
+			return c.branchComparison(e, when)
+		}
+	}
+
+	e.Visit(c)
+	return c.branchOnValue(JUMP_WHEN_ZERO, !when)
+}
+
+// branchLogical branches on && when decisive is false, or on || when it is
+// true. The left side alone decides when its truth equals decisive.
+func (c *Compiler) branchLogical(e ast.Binary, decisive bool, when bool) []int {
+	if decisive == when {
+		positions := c.branch(e.Left, when)
+		return append(positions, c.branch(e.Right, when)...)
+	}
+
+	decided := c.branch(e.Left, decisive)
+	positions := c.branch(e.Right, when)
+
+	decidedLabel := c.markJumpLabel()
+	for _, pos := range decided {
+		c.confirmJumpLabel(pos, decidedLabel)
+	}
+
+	return positions
+}
+
+// branchComparison subtracts the operands so that the comparison is decided
+// by the sign of the difference or by it being zero.
+func (c *Compiler) branchComparison(e ast.Binary, when bool) []int {
+	e.Left.Visit(c)
+	c.hold(1)
+	e.Right.Visit(c)
+	c.release(1)
+
+	switch e.Operator.Type {
+	// a <= b and a > b are decided by b - a < 0
+	case token.LTEQ, token.GT:
+		c.addInstruction(SWAP)
+	}
+	c.addInstruction(SUB)
+
+	switch e.Operator.Type {
+	case token.LT, token.GT:
+		return c.branchOnValue(JUMP_WHEN_NEGA, when)
+	case token.LTEQ, token.GTEQ:
+		return c.branchOnValue(JUMP_WHEN_NEGA, !when)
+	case token.EQ:
+		return c.branchOnValue(JUMP_WHEN_ZERO, when)
+	default:
+		return c.branchOnValue(JUMP_WHEN_ZERO, !when)
+	}
+}
+
+// branchOnValue jumps with instruction when taken is true, and jumps when it
+// is not taken otherwise.
+func (c *Compiler) branchOnValue(instruction InstructionType, taken bool) []int {
+	if taken {
+		return []int{c.reserveJumpLabel(instruction)}
+	}
+
+	skipPos := c.reserveJumpLabel(instruction)
+	pos := c.reserveJumpLabel(JUMP)
+	skipLabel := c.markJumpLabel()
+	c.confirmJumpLabel(skipPos, skipLabel)
+
+	return []int{pos}
+}
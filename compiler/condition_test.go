@@ -0,0 +1,55 @@
+package compiler
+
+import "testing"
+
+func TestCompileBranchComparison(t *testing.T) {
+	input := "func f(a, b) { if (a <= b && a != 0) 1; }"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.BranchConditions = true }, t)
+	expects := []string{
+		"TTT",   // end
+		"TFFFT", // mark label f
+
+		// a <= b
+		"FLFFLT", // copy 1 (a)
+		"FLFFLT", // copy 1 (b)
+		"FTL",    // swap
+		"LFFL",   // sub
+		"TLLLT",  // jump 1 when negative
+
+		// a != 0
+		"FLFFLT", // copy 1 (a)
+		"FFFFT",  // push 0
+		"LFFL",   // sub
+		"TLFLT",  // jump 1 when zero
+
+		"FFFLT",  // push 1
+		"FTT",    // discard
+		"TFTLFT", // jump 2
+		"TFFLT",  // mark label 1
+		"TFFLFT", // mark label 2
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileBranchNegation(t *testing.T) {
+	input := "func f(a) { while (!a) 1; }"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.BranchConditions = true }, t)
+	expects := []string{
+		"TTT",   // end
+		"TFFFT", // mark label f
+
+		"TFFLT",  // mark label 1
+		"FLFFFT", // copy 0 (a)
+		"TLFLFT", // jump 2 when zero
+		"TFTLLT", // jump 3
+		"TFFLFT", // mark label 2
+
+		"FFFLT",  // push 1
+		"FTT",    // discard
+		"TFTLT",  // jump 1
+		"TFFLLT", // mark label 3
+	}
+
+	assertInstructions(instructions, expects, t)
+}
@@ -0,0 +1,365 @@
+package compiler
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/token"
+)
+
+// ConstantFolder evaluates constant expressions before compiling, replaces
+// globals which are never reassigned by their constant values, and removes
+// the branches of if statements which are never taken.
+//
+// Globals are replaced only in the top level code after their declarations.
+// Functions are left alone, since they may be called before the declaration
+// runs and read the global uninitialized.
+//
+// Every folded expression still pushes exactly one value, so the stack
+// offsets of arguments computed by the parser remain valid.
+type ConstantFolder struct {
+	statements []ast.Statement
+	// collecting is set while the first pass counts the writes of globals.
+	collecting bool
+	writes     map[string]int
+	constants  map[string]ast.Expression
+	// inFunction is set while folding the body of a function.
+	inFunction bool
+	expression ast.Expression
+	statement  ast.Statement
+}
+
+func NewConstantFolder(statements []ast.Statement) *ConstantFolder {
+	return &ConstantFolder{
+		statements: statements,
+		writes:     map[string]int{},
+		constants:  map[string]ast.Expression{},
+	}
+}
+
+func (f *ConstantFolder) Fold() []ast.Statement {
+	f.collecting = true
+	f.foldStatements(f.statements)
+	f.collecting = false
+
+	return f.foldStatements(f.statements)
+}
+
+func (f *ConstantFolder) foldStatements(statements []ast.Statement) []ast.Statement {
+	folded := []ast.Statement{}
+	for _, stmt := range statements {
+		folded = append(folded, f.foldStatement(stmt))
+	}
+
+	return folded
+}
+
+func (f *ConstantFolder) foldStatement(stmt ast.Statement) ast.Statement {
+	stmt.Visit(f)
+	return f.statement
+}
+
+func (f *ConstantFolder) foldExpression(e ast.Expression) ast.Expression {
+	e.Visit(f)
+	return f.expression
+}
+
+func (f *ConstantFolder) VisitVar(s ast.Var) {
+	s.Expression = f.foldExpression(s.Expression)
+
+	if !s.IsLocal {
+		name := mangle(s.Module, s.Identifier.Literal)
+		if f.collecting {
+			f.writes[name]++
+		} else if _, ok := constantValue(s.Expression); ok && f.writes[name] == 1 {
+			f.constants[name] = s.Expression
+		}
+	}
+
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitFunction(s ast.Function) {
+	enclosing := f.inFunction
+	f.inFunction = true
+	s.Body = f.foldStatements(s.Body)
+	f.inFunction = enclosing
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitReturn(s ast.Return) {
+	if s.Value != nil {
+		s.Value = f.foldExpression(s.Value)
+	}
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitBreak(s ast.Break) { f.statement = s }
+
+func (f *ConstantFolder) VisitIf(s ast.If) {
+	s.Condition = f.foldExpression(s.Condition)
+	s.Then = f.foldStatement(s.Then)
+	if s.Else != nil {
+		s.Else = f.foldStatement(s.Else)
+	}
+
+	condition, ok := constantValue(s.Condition)
+	if !ok {
+		f.statement = s
+	} else if condition != 0 {
+		f.statement = s.Then
+	} else if s.Else != nil {
+		f.statement = s.Else
+	} else {
+		f.statement = ast.Block{Statements: []ast.Statement{}}
+	}
+}
+
+func (f *ConstantFolder) VisitWhile(s ast.While) {
+	s.Condition = f.foldExpression(s.Condition)
+	s.Body = f.foldStatement(s.Body)
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitBlock(s ast.Block) {
+	s.Statements = f.foldStatements(s.Statements)
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitExpression(s ast.ExpressionStatement) {
+	s.Expression = f.foldExpression(s.Expression)
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitAssert(s ast.Assert) {
+	s.Condition = f.foldExpression(s.Condition)
+	f.statement = s
+}
+
+func (f *ConstantFolder) VisitAsmStatement(s ast.AsmStatement) { f.statement = s }
+
+func (f *ConstantFolder) VisitAssign(e ast.Assign) {
+	switch target := e.Target.(type) {
+	case ast.Variable:
+		if f.collecting && target.Type != ast.LOCAL && target.Type != ast.ARGUMENT {
+			f.writes[mangle(target.Module, target.Identifier.Literal)]++
+		}
+	case ast.Index:
+		target.Receiver = f.foldExpression(target.Receiver)
+		target.Index = f.foldExpression(target.Index)
+		e.Target = target
+	}
+
+	e.Expression = f.foldExpression(e.Expression)
+	f.expression = e
+}
+
+func (f *ConstantFolder) VisitBinaryExpression(e ast.Binary) {
+	e.Left = f.foldExpression(e.Left)
+	divisor := f.foldExpression(e.Right)
+	// A divisor folded to zero is left as written, so that only the zeros the
+	// user wrote are reported, and a guarded division by a global compiles.
+	if value, ok := constantValue(divisor); !ok || value != 0 ||
+		(e.Operator.Type != token.SLASH && e.Operator.Type != token.MOD) {
+		e.Right = divisor
+	}
+	f.expression = e
+
+	left, leftOk := constantValue(e.Left)
+	right, rightOk := constantValue(e.Right)
+
+	// Logical operations skip the right side when the left side decides.
+	switch e.Operator.Type {
+	case token.AND:
+		if leftOk && left == 0 {
+			f.expression = booleanLiteral(e.Operator, false)
+		} else if leftOk && rightOk {
+			f.expression = booleanLiteral(e.Operator, right != 0)
+		}
+		return
+	case token.OR:
+		if leftOk && left != 0 {
+			f.expression = booleanLiteral(e.Operator, true)
+		} else if leftOk && rightOk {
+			f.expression = booleanLiteral(e.Operator, right != 0)
+		}
+		return
+	}
+
+	if !leftOk || !rightOk {
+		return
+	}
+
+	switch e.Operator.Type {
+	case token.PLUS:
+		if value, ok := addInt(left, right); ok {
+			f.expression = integerLiteral(e.Operator, value)
+		}
+	case token.MINUS:
+		if right != math.MinInt64 {
+			if value, ok := addInt(left, -right); ok {
+				f.expression = integerLiteral(e.Operator, value)
+			}
+		}
+	case token.ASTERISK:
+		if value, ok := mulInt(left, right); ok {
+			f.expression = integerLiteral(e.Operator, value)
+		}
+	// The rounding of negative operands is left to the VM.
+	case token.SLASH:
+		if left >= 0 && right > 0 {
+			f.expression = integerLiteral(e.Operator, left/right)
+		}
+	case token.MOD:
+		if left >= 0 && right > 0 {
+			f.expression = integerLiteral(e.Operator, left%right)
+		}
+	case token.LT:
+		f.expression = booleanLiteral(e.Operator, left < right)
+	case token.LTEQ:
+		f.expression = booleanLiteral(e.Operator, left <= right)
+	case token.GT:
+		f.expression = booleanLiteral(e.Operator, left > right)
+	case token.GTEQ:
+		f.expression = booleanLiteral(e.Operator, left >= right)
+	case token.EQ:
+		f.expression = booleanLiteral(e.Operator, left == right)
+	case token.NOT_EQ:
+		f.expression = booleanLiteral(e.Operator, left != right)
+	}
+}
+
+func (f *ConstantFolder) VisitUnaryExpression(e ast.Unary) {
+	e.Right = f.foldExpression(e.Right)
+	f.expression = e
+
+	value, ok := constantValue(e.Right)
+	if !ok {
+		return
+	}
+
+	switch e.Operator.Type {
+	case token.MINUS:
+		if value != math.MinInt64 {
+			f.expression = integerLiteral(e.Operator, -value)
+		}
+	case token.BANG:
+		f.expression = booleanLiteral(e.Operator, value == 0)
+	}
+}
+
+func (f *ConstantFolder) VisitCall(e ast.Call) {
+	arguments := []ast.Expression{}
+	for _, arg := range e.Arguments {
+		arguments = append(arguments, f.foldExpression(arg))
+	}
+	e.Arguments = arguments
+	f.expression = e
+
+	if _, ok := lookupBuildinFunction(e); !ok || e.Callee.Literal != "len" {
+		return
+	}
+
+	switch array := e.Arguments[0].(type) {
+	case ast.StringLiteral:
+		f.expression = integerLiteral(e.Callee, int64(len(array.Token.Literal)))
+	case ast.ArrayLiteral:
+		for _, element := range array.Elements {
+			if _, ok := constantValue(element); !ok {
+				return
+			}
+		}
+		f.expression = integerLiteral(e.Callee, int64(len(array.Elements)))
+	}
+}
+
+func (f *ConstantFolder) VisitIntegerLiteral(e ast.IntegerLiteral) { f.expression = e }
+func (f *ConstantFolder) VisitCharLiteral(e ast.CharLiteral)       { f.expression = e }
+func (f *ConstantFolder) VisitStringLiteral(e ast.StringLiteral)   { f.expression = e }
+func (f *ConstantFolder) VisitBooleanLiteral(e ast.BooleanLiteral) { f.expression = e }
+
+func (f *ConstantFolder) VisitVariable(e ast.Variable) {
+	f.expression = e
+
+	if e.Type == ast.LOCAL || e.Type == ast.ARGUMENT || f.inFunction {
+		return
+	}
+
+	if constant, ok := f.constants[mangle(e.Module, e.Identifier.Literal)]; ok {
+		f.expression = constant
+	}
+}
+
+func (f *ConstantFolder) VisitArrayLiteral(e ast.ArrayLiteral) {
+	elements := []ast.Expression{}
+	for _, element := range e.Elements {
+		elements = append(elements, f.foldExpression(element))
+	}
+	e.Elements = elements
+	f.expression = e
+}
+
+func (f *ConstantFolder) VisitAsm(e ast.Asm) { f.expression = e }
+
+func (f *ConstantFolder) VisitIndex(e ast.Index) {
+	e.Receiver = f.foldExpression(e.Receiver)
+	e.Index = f.foldExpression(e.Index)
+	f.expression = e
+}
+
+// constantValue returns the value pushed by a literal other than strings.
+func constantValue(e ast.Expression) (int64, bool) {
+	switch l := e.(type) {
+	case ast.IntegerLiteral:
+		return l.Value, true
+	case ast.CharLiteral:
+		return int64([]rune(l.Value)[0]), true
+	case ast.BooleanLiteral:
+		if l.Value {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func integerLiteral(tok token.Token, value int64) ast.Expression {
+	tok.Type = token.INT
+	tok.Literal = strconv.FormatInt(value, 10)
+	return ast.IntegerLiteral{Token: tok, Value: value}
+}
+
+func booleanLiteral(tok token.Token, value bool) ast.Expression {
+	if value {
+		tok.Type = token.TRUE
+		tok.Literal = "true"
+	} else {
+		tok.Type = token.FALSE
+		tok.Literal = "false"
+	}
+	return ast.BooleanLiteral{Token: tok, Value: value}
+}
+
+func addInt(a int64, b int64) (int64, bool) {
+	sum := a + b
+	if (a >= 0) == (b >= 0) && (sum >= 0) != (a >= 0) {
+		return 0, false
+	}
+
+	return sum, true
+}
+
+func mulInt(a int64, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+
+	return product, true
+}
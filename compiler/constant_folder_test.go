@@ -0,0 +1,113 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/lexer"
+	"github.com/simomu-github/sfflt_lang/parser"
+)
+
+func TestFoldConstantExpressions(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect int64
+	}{
+		{"60 * 60 * 24;", 86400},
+		{"-(1 + 2);", -3},
+		{"7 % 3 - 'a';", -96},
+		{"len(\"abc\");", 3},
+		{"len([1, 2]);", 2},
+		{"1 < 2 && 3 != 3;", 0},
+		{"false && getn();", 0},
+		{"true || getn();", 1},
+		{"!(2 >= 3);", 1},
+	}
+
+	for _, tt := range tests {
+		statements := fold(tt.input, t)
+		expression := statements[0].(ast.ExpressionStatement).Expression
+		value, ok := constantValue(expression)
+		if !ok {
+			t.Fatalf("%q is not folded. got=%T", tt.input, expression)
+		}
+		if value != tt.expect {
+			t.Fatalf("%q is folded wrong. expected=%d, got=%d", tt.input, tt.expect, value)
+		}
+	}
+}
+
+func TestFoldKeepsSideEffects(t *testing.T) {
+	inputs := []string{
+		"getn() && false;",
+		"1 / 0;",
+		"-7 / 2;",
+		"len([getn()]);",
+		"9223372036854775807 + 1;",
+	}
+
+	for _, input := range inputs {
+		statements := fold(input, t)
+		expression := statements[0].(ast.ExpressionStatement).Expression
+		if _, ok := constantValue(expression); ok {
+			t.Fatalf("%q should not be folded.", input)
+		}
+	}
+}
+
+func TestFoldPropagatesGlobals(t *testing.T) {
+	input := "var a = 2; var b = a * 3; var c = 1; c = 2; b; c;"
+	statements := fold(input, t)
+
+	b := statements[4].(ast.ExpressionStatement).Expression
+	if value, ok := constantValue(b); !ok || value != 6 {
+		t.Fatalf("b is not propagated. got=%T", b)
+	}
+
+	c := statements[5].(ast.ExpressionStatement).Expression
+	if _, ok := c.(ast.Variable); !ok {
+		t.Fatalf("reassigned c should not be propagated. got=%T", c)
+	}
+}
+
+func TestFoldKeepsGlobalsInFunctions(t *testing.T) {
+	input := "show(); var g = 5; func show() { putn(g); } show(); g;"
+	statements := fold(input, t)
+
+	function := statements[2].(ast.Function)
+	call := function.Body[0].(ast.ExpressionStatement).Expression.(ast.Call)
+	if _, ok := call.Arguments[0].(ast.Variable); !ok {
+		t.Fatalf("g read before its declaration should not be propagated. got=%T", call.Arguments[0])
+	}
+
+	g := statements[4].(ast.ExpressionStatement).Expression
+	if value, ok := constantValue(g); !ok || value != 5 {
+		t.Fatalf("g is not propagated after its declaration. got=%T", g)
+	}
+}
+
+func TestFoldPrunesIf(t *testing.T) {
+	input := "if (1 > 2) putn(1); else putn(2); if (false) putn(3);"
+	statements := fold(input, t)
+
+	call := statements[0].(ast.ExpressionStatement).Expression.(ast.Call)
+	if value, _ := constantValue(call.Arguments[0]); value != 2 {
+		t.Fatalf("else branch is not selected. got=%d", value)
+	}
+
+	block := statements[1].(ast.Block)
+	if len(block.Statements) != 0 {
+		t.Fatalf("if (false) is not removed. got=%d statements", len(block.Statements))
+	}
+}
+
+func fold(input string, t *testing.T) []ast.Statement {
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	statements := parser.ParseProgram()
+	if parser.HadErrors() {
+		t.Fatalf("parse error. %v", parser.Errors)
+	}
+
+	return NewConstantFolder(statements).Fold()
+}
@@ -0,0 +1,241 @@
+package compiler
+
+import (
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/token"
+)
+
+// DeadCodeEliminator removes the functions which are never called from the
+// main program, the globals which are never read, and the statements after
+// an unconditional return or break.
+type DeadCodeEliminator struct {
+	statements []ast.Statement
+	functions  map[string]*liveFunction
+	current    *liveFunction
+	reachable  map[string]bool
+	read       map[string]bool
+}
+
+// liveFunction records the functions called and the globals read by the
+// main program or a function.
+type liveFunction struct {
+	callees []string
+	reads   []string
+}
+
+func NewDeadCodeEliminator(statements []ast.Statement) *DeadCodeEliminator {
+	return &DeadCodeEliminator{
+		statements: statements,
+		functions:  map[string]*liveFunction{},
+		reachable:  map[string]bool{},
+		read:       map[string]bool{},
+	}
+}
+
+func (d *DeadCodeEliminator) Eliminate() []ast.Statement {
+	main := &liveFunction{}
+	d.current = main
+	for _, stmt := range d.statements {
+		stmt.Visit(d)
+	}
+
+	d.markReachable(main)
+
+	statements := []ast.Statement{}
+	for _, stmt := range d.eliminateStatements(d.statements) {
+		switch s := stmt.(type) {
+		case ast.Function:
+			if !d.reachable[mangle(s.Module, s.Name.Literal)] {
+				continue
+			}
+		case ast.Var:
+			if !s.IsLocal && !d.read[mangle(s.Module, s.Identifier.Literal)] {
+				if hasSideEffects(s.Expression) {
+					statements = append(statements, ast.ExpressionStatement{Expression: s.Expression})
+				}
+				continue
+			}
+		}
+
+		statements = append(statements, stmt)
+	}
+
+	return statements
+}
+
+// markReachable marks the functions called from f and the globals they read.
+func (d *DeadCodeEliminator) markReachable(f *liveFunction) {
+	for _, name := range f.reads {
+		d.read[name] = true
+	}
+
+	for _, name := range f.callees {
+		callee, ok := d.functions[name]
+		if !ok || d.reachable[name] {
+			continue
+		}
+
+		d.reachable[name] = true
+		d.markReachable(callee)
+	}
+}
+
+// eliminateStatements drops the statements following a return or a break,
+// which are never executed.
+func (d *DeadCodeEliminator) eliminateStatements(statements []ast.Statement) []ast.Statement {
+	live := []ast.Statement{}
+	for _, stmt := range statements {
+		live = append(live, d.eliminateStatement(stmt))
+
+		switch stmt.(type) {
+		case ast.Return, ast.Break:
+			return live
+		}
+	}
+
+	return live
+}
+
+func (d *DeadCodeEliminator) eliminateStatement(stmt ast.Statement) ast.Statement {
+	switch s := stmt.(type) {
+	case ast.Function:
+		s.Body = d.eliminateStatements(s.Body)
+		return s
+	case ast.Block:
+		s.Statements = d.eliminateStatements(s.Statements)
+		return s
+	case ast.If:
+		s.Then = d.eliminateStatement(s.Then)
+		if s.Else != nil {
+			s.Else = d.eliminateStatement(s.Else)
+		}
+		return s
+	case ast.While:
+		s.Body = d.eliminateStatement(s.Body)
+		return s
+	}
+
+	return stmt
+}
+
+// hasSideEffects reports whether evaluating e may do more than pushing a
+// value, so that it is kept even if the value is unused.
+func hasSideEffects(e ast.Expression) bool {
+	switch e := e.(type) {
+	case ast.IntegerLiteral, ast.CharLiteral, ast.BooleanLiteral, ast.StringLiteral, ast.Variable:
+		return false
+	case ast.Unary:
+		return hasSideEffects(e.Right)
+	case ast.Binary:
+		// division may stop the program in checked mode
+		if e.Operator.Type == token.SLASH || e.Operator.Type == token.MOD {
+			return true
+		}
+		return hasSideEffects(e.Left) || hasSideEffects(e.Right)
+	case ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			if hasSideEffects(element) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func (d *DeadCodeEliminator) VisitVar(s ast.Var) { s.Expression.Visit(d) }
+
+func (d *DeadCodeEliminator) VisitFunction(s ast.Function) {
+	enclosing := d.current
+	d.current = &liveFunction{}
+	d.functions[mangle(s.Module, s.Name.Literal)] = d.current
+
+	for _, stmt := range s.Body {
+		stmt.Visit(d)
+	}
+
+	d.current = enclosing
+}
+
+func (d *DeadCodeEliminator) VisitReturn(s ast.Return) {
+	if s.Value != nil {
+		s.Value.Visit(d)
+	}
+}
+
+func (d *DeadCodeEliminator) VisitBreak(s ast.Break) {}
+
+func (d *DeadCodeEliminator) VisitIf(s ast.If) {
+	s.Condition.Visit(d)
+	s.Then.Visit(d)
+	if s.Else != nil {
+		s.Else.Visit(d)
+	}
+}
+
+func (d *DeadCodeEliminator) VisitWhile(s ast.While) {
+	s.Condition.Visit(d)
+	s.Body.Visit(d)
+}
+
+func (d *DeadCodeEliminator) VisitBlock(s ast.Block) {
+	for _, stmt := range s.Statements {
+		stmt.Visit(d)
+	}
+}
+
+func (d *DeadCodeEliminator) VisitExpression(s ast.ExpressionStatement) { s.Expression.Visit(d) }
+func (d *DeadCodeEliminator) VisitAssert(s ast.Assert)                  { s.Condition.Visit(d) }
+func (d *DeadCodeEliminator) VisitAsmStatement(s ast.AsmStatement)      { d.VisitAsm(s.Asm) }
+
+func (d *DeadCodeEliminator) VisitAssign(e ast.Assign) {
+	if index, ok := e.Target.(ast.Index); ok {
+		index.Receiver.Visit(d)
+		index.Index.Visit(d)
+	}
+	e.Expression.Visit(d)
+}
+
+func (d *DeadCodeEliminator) VisitBinaryExpression(e ast.Binary) { e.Left.Visit(d); e.Right.Visit(d) }
+func (d *DeadCodeEliminator) VisitUnaryExpression(e ast.Unary)   { e.Right.Visit(d) }
+
+func (d *DeadCodeEliminator) VisitCall(e ast.Call) {
+	for _, arg := range e.Arguments {
+		arg.Visit(d)
+	}
+
+	if _, ok := lookupBuildinFunction(e); !ok {
+		d.current.callees = append(d.current.callees, mangle(e.Module, e.Callee.Literal))
+	}
+}
+
+func (d *DeadCodeEliminator) VisitIntegerLiteral(e ast.IntegerLiteral) {}
+func (d *DeadCodeEliminator) VisitCharLiteral(e ast.CharLiteral)       {}
+func (d *DeadCodeEliminator) VisitStringLiteral(e ast.StringLiteral)   {}
+func (d *DeadCodeEliminator) VisitBooleanLiteral(e ast.BooleanLiteral) {}
+
+func (d *DeadCodeEliminator) VisitVariable(e ast.Variable) {
+	if e.Type != ast.LOCAL && e.Type != ast.ARGUMENT {
+		d.current.reads = append(d.current.reads, mangle(e.Module, e.Identifier.Literal))
+	}
+}
+
+func (d *DeadCodeEliminator) VisitArrayLiteral(e ast.ArrayLiteral) {
+	for _, element := range e.Elements {
+		element.Visit(d)
+	}
+}
+
+func (d *DeadCodeEliminator) VisitIndex(e ast.Index) {
+	e.Receiver.Visit(d)
+	e.Index.Visit(d)
+}
+
+func (d *DeadCodeEliminator) VisitAsm(e ast.Asm) {
+	for _, instruction := range e.Instructions {
+		if instruction.Mnemonic.Literal == mnemonics[CALLSUB] {
+			d.current.callees = append(d.current.callees, mangle(e.Module, instruction.Operand.Literal))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/lexer"
+	"github.com/simomu-github/sfflt_lang/parser"
+)
+
+func TestEliminateUnreachableFunctions(t *testing.T) {
+	input := "func a() { b(); } func b() { 1; } func c() { c(); } a();"
+	statements := eliminate(input, t)
+
+	names := []string{}
+	for _, stmt := range statements {
+		if f, ok := stmt.(ast.Function); ok {
+			names = append(names, f.Name.Literal)
+		}
+	}
+
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("reachable functions wrong. expected=[a b], got=%v", names)
+	}
+}
+
+func TestEliminateUnreadGlobals(t *testing.T) {
+	input := "var a = 1; var b = getn(); var c = 2; c = 3; var d = 4; putn(d);"
+	statements := eliminate(input, t)
+
+	if len(statements) != 4 {
+		t.Fatalf("statements length wrong. expected=4, got=%d", len(statements))
+	}
+
+	if _, ok := statements[0].(ast.ExpressionStatement).Expression.(ast.Call); !ok {
+		t.Fatalf("initializer of b should be kept. got=%T", statements[0])
+	}
+
+	if _, ok := statements[1].(ast.ExpressionStatement).Expression.(ast.Assign); !ok {
+		t.Fatalf("assignment to c should be kept. got=%T", statements[1])
+	}
+
+	if d, ok := statements[2].(ast.Var); !ok || d.Identifier.Literal != "d" {
+		t.Fatalf("read d should be kept. got=%T", statements[2])
+	}
+}
+
+func TestEliminateStatementsAfterReturn(t *testing.T) {
+	input := "func f() { while (true) { break; putn(1); } return 1; putn(2); } f();"
+	statements := eliminate(input, t)
+
+	body := statements[0].(ast.Function).Body
+	if len(body) != 2 {
+		t.Fatalf("function body length wrong. expected=2, got=%d", len(body))
+	}
+
+	loop := body[0].(ast.While).Body.(ast.Block)
+	if len(loop.Statements) != 1 {
+		t.Fatalf("loop body length wrong. expected=1, got=%d", len(loop.Statements))
+	}
+}
+
+func eliminate(input string, t *testing.T) []ast.Statement {
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	statements := parser.ParseProgram()
+	if parser.HadErrors() {
+		t.Fatalf("parse error. %v", parser.Errors)
+	}
+
+	return NewDeadCodeEliminator(statements).Eliminate()
+}
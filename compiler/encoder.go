@@ -0,0 +1,112 @@
+package compiler
+
+import "strings"
+
+// Encode converts instructions into FFLT, one string for each instruction.
+func Encode(instructions []Instruction) []string {
+	encoded := []string{}
+	for _, instruction := range instructions {
+		encoded = append(encoded, instruction.Encode())
+	}
+
+	return encoded
+}
+
+func (i Instruction) Encode() string {
+	switch {
+	case i.Op.HasArg():
+		return string(i.Op) + encodeNumber(i.Arg) + "T"
+	case i.Op.HasLabel():
+		return string(i.Op) + intToBinary(int64(i.Label)) + "T"
+	}
+
+	return string(i.Op)
+}
+
+// encodeNumber writes the sign of value followed by its absolute value in
+// binary.
+func encodeNumber(value int64) string {
+	if value < 0 {
+		return NEGA + intToBinary(value)
+	}
+
+	return POSI + intToBinary(value)
+}
+
+func intToBinary(value int64) string {
+	binary := []string{}
+
+	decimal := value
+	for {
+		bin := decimal % 2
+		if bin == 0 {
+			binary = append(binary, "F")
+		} else {
+			binary = append(binary, "L")
+		}
+		decimal /= 2
+
+		if decimal == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < len(binary)/2; i++ {
+		binary[i], binary[len(binary)-i-1] = binary[len(binary)-i-1], binary[i]
+	}
+	return strings.Join(binary, "")
+}
+
+// Opcodes lists every instruction type. The encodings are prefix free, so an
+// instruction is decoded by the opcode it starts with.
+var Opcodes = []InstructionType{
+	PUSH, DUP, SWAP, DISCARD, COPY, SLIDE,
+	ADD, SUB, MUL, DIV, MOD,
+	STORE, RETRIEVE,
+	GETC, GETN, PUTC, PUTN,
+	LABEL, JUMP, JUMP_WHEN_ZERO, JUMP_WHEN_NEGA,
+	CALLSUB, ENDSUB,
+	END,
+}
+
+// decodeInstruction converts an encoded instruction back into an Instruction.
+func decodeInstruction(encoded string) Instruction {
+	for _, op := range Opcodes {
+		if !strings.HasPrefix(encoded, string(op)) {
+			continue
+		}
+
+		param := strings.TrimSuffix(encoded[len(op):], "T")
+		switch {
+		case op.HasArg():
+			return Instruction{Op: op, Arg: DecodeNumber(param)}
+		case op.HasLabel():
+			return Instruction{Op: op, Label: int(DecodeBinary(param))}
+		}
+		return Instruction{Op: op}
+	}
+
+	return Instruction{}
+}
+
+// DecodeNumber converts a sign followed by binary digits into its value.
+func DecodeNumber(param string) int64 {
+	if strings.HasPrefix(param, NEGA) {
+		return -DecodeBinary(param[1:])
+	}
+
+	return DecodeBinary(param[1:])
+}
+
+// DecodeBinary converts binary digits into their value.
+func DecodeBinary(digits string) int64 {
+	value := int64(0)
+	for _, digit := range digits {
+		value *= 2
+		if digit == 'L' {
+			value++
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,50 @@
+package compiler
+
+import "testing"
+
+func TestEncode(t *testing.T) {
+	instructions := []Instruction{
+		{Op: PUSH, Arg: 5},
+		{Op: PUSH, Arg: -2},
+		{Op: PUSH, Arg: 0},
+		{Op: COPY, Arg: 1},
+		{Op: SLIDE, Arg: 3},
+		{Op: LABEL, Label: 0},
+		{Op: JUMP_WHEN_NEGA, Label: 6},
+		{Op: CALLSUB, Label: 2},
+		{Op: ADD},
+		{Op: END},
+	}
+	expects := []string{
+		"FFFLFLT", // push 5
+		"FFLLFT",  // push -2
+		"FFFFT",   // push 0
+		"FLFFLT",  // copy 1
+		"FLTFLLT", // slide 3
+		"TFFFT",   // mark label 0
+		"TLLLLFT", // jump 6 when negative
+		"TFLLFT",  // call 2
+		"LFFF",    // add
+		"TTT",     // end
+	}
+
+	actuals := Encode(instructions)
+	for i, expect := range expects {
+		if actuals[i] != expect {
+			t.Fatalf("tests[%d] - instruction wrong. expected=%q, got=%q", i, expect, actuals[i])
+		}
+
+		if decoded := decodeInstruction(expect); decoded != instructions[i] {
+			t.Fatalf("tests[%d] - decoded instruction wrong. expected=%+v, got=%+v", i, instructions[i], decoded)
+		}
+	}
+}
+
+func decodeInstructions(encoded []string) []Instruction {
+	instructions := []Instruction{}
+	for _, instruction := range encoded {
+		instructions = append(instructions, decodeInstruction(instruction))
+	}
+
+	return instructions
+}
@@ -0,0 +1,55 @@
+package compiler
+
+import "github.com/simomu-github/sfflt_lang/ast"
+
+// frame describes the call frame of main or of the function being compiled.
+// Local variables come first, followed by the slots the operand stack is
+// spilled into so that the garbage collector can find its roots.
+type frame struct {
+	locals int
+	spills int
+	// stack is the number of values the frame keeps on the operand stack
+	// below the expression being compiled, including the arguments.
+	stack int
+	// inlineSlot is the first free slot for the local variables of inlined
+	// functions, which follow the local variables of the frame itself.
+	inlineSlot    int
+	sizePositions []int
+}
+
+func newFrame(locals int, params int) *frame {
+	return &frame{locals: locals, stack: params, inlineSlot: locals}
+}
+
+// frameSize returns the number of slots for the local variables declared in
+// statements, not including the ones in function declarations.
+func frameSize(statements []ast.Statement) int {
+	size := 0
+
+	var walk func(stmt ast.Statement)
+	walk = func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case ast.Var:
+			if s.IsLocal && s.Slot+1 > size {
+				size = s.Slot + 1
+			}
+		case ast.Block:
+			for _, stmt := range s.Statements {
+				walk(stmt)
+			}
+		case ast.If:
+			walk(s.Then)
+			if s.Else != nil {
+				walk(s.Else)
+			}
+		case ast.While:
+			walk(s.Body)
+		}
+	}
+
+	for _, stmt := range statements {
+		walk(stmt)
+	}
+
+	return size
+}
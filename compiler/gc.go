@@ -0,0 +1,216 @@
+package compiler
+
+// GC_THRESHOLD is the number of cells allocated since the last collection
+// that triggers the next one.
+const GC_THRESHOLD = int64(1) << 14
+
+// spillStack copies the values the current frame keeps on the operand stack
+// into its spill slots, which the collector scans as roots.
+// above is the number of values pushed on top of them.
+func (c *Compiler) spillStack(above int) {
+	c.spillValues(c.currentFrame().stack, above)
+}
+
+// spillValues is spillStack for count values, which asm blocks use since the
+// values they push are not held in the frame.
+func (c *Compiler) spillValues(count int, above int) {
+	if c.DisableGC {
+		return
+	}
+
+	f := c.currentFrame()
+	for i := 0; i < count; i++ {
+		c.pushLocalVariableAddress(f.locals + i)
+		c.addInstructionWithArg(COPY, int64(count-i+above))
+		c.addInstruction(STORE)
+	}
+
+	if count > f.spills {
+		f.spills = count
+	}
+}
+
+// pushFrameTop pushes the end of the current frame, which is the end of the
+// frame region scanned by the collector.
+func (c *Compiler) pushFrameTop() {
+	c.addInstructionWithArg(PUSH, VM_FRAME_POINTER)
+	c.addInstruction(RETRIEVE)
+	c.pushFrameSize()
+	c.addInstruction(ADD)
+}
+
+// collectRoutine emits _collect(frame_top), which marks the blocks reachable
+// from the globals and the frame region and frees the others.
+func (c *Compiler) collectRoutine(label int, markLabel int) {
+	c.addInstructionWithLabel(LABEL, label)
+
+	globalEnd := GLOBAL_VAR_ADDR + int64(len(c.symbols.globals))
+	c.addInstructionWithArg(PUSH, globalEnd)
+	c.addInstructionWithArg(PUSH, GLOBAL_VAR_ADDR)
+	c.scanRoots(markLabel)
+
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(PUSH, LOCAL_VAR_ADDR)
+	c.scanRoots(markLabel)
+	c.addInstruction(DISCARD)
+
+	// sweep
+	c.addInstructionWithArg(PUSH, HEAP_ADDR)
+	loopLabel := c.markJumpLabel()
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(PUSH, VM_ALLOC_REC)
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(SUB)
+	bodyPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	endPos := c.reserveJumpLabel(JUMP)
+
+	bodyLabel := c.markJumpLabel()
+	c.confirmJumpLabel(bodyPos, bodyLabel)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(DUP)
+	freePos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	c.addInstructionWithArg(PUSH, BLOCK_MARKED)
+	c.addInstruction(SUB)
+	unmarkPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	nextPos := c.reserveJumpLabel(JUMP) // already free
+
+	unmarkLabel := c.markJumpLabel()
+	c.confirmJumpLabel(unmarkPos, unmarkLabel)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstructionWithArg(PUSH, BLOCK_UNMARKED)
+	c.addInstruction(STORE)
+	unmarkNextPos := c.reserveJumpLabel(JUMP)
+
+	freeLabel := c.markJumpLabel()
+	c.confirmJumpLabel(freePos, freeLabel)
+	c.addInstruction(DISCARD)
+	c.addInstruction(DUP)
+	c.addInstructionWithLabel(CALLSUB, c.freeLabel)
+
+	nextLabel := c.markJumpLabel()
+	c.confirmJumpLabel(nextPos, nextLabel)
+	c.confirmJumpLabel(unmarkNextPos, nextLabel)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_BLOCK_TABLE)
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(ADD)
+	c.addInstructionWithLabel(JUMP, loopLabel)
+
+	endLabel := c.markJumpLabel()
+	c.confirmJumpLabel(endPos, endLabel)
+	c.addInstruction(DISCARD)
+	c.addInstruction(ENDSUB)
+}
+
+// scanRoots marks the values stored from the address on the top of the stack
+// up to the address below it, and consumes both.
+func (c *Compiler) scanRoots(markLabel int) {
+	loopLabel := c.markJumpLabel()
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(COPY, 2) // end
+	c.addInstruction(SUB)
+	bodyPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	endPos := c.reserveJumpLabel(JUMP)
+
+	bodyLabel := c.markJumpLabel()
+	c.confirmJumpLabel(bodyPos, bodyLabel)
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE)
+	c.addInstructionWithLabel(CALLSUB, markLabel)
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstruction(ADD)
+	c.addInstructionWithLabel(JUMP, loopLabel)
+
+	endLabel := c.markJumpLabel()
+	c.confirmJumpLabel(endPos, endLabel)
+	c.addInstruction(DISCARD)
+	c.addInstruction(DISCARD)
+}
+
+// markRoutine emits _mark(value). Any value pointing to the start of an
+// allocated block is treated as a pointer, and the elements of the block are
+// marked recursively.
+func (c *Compiler) markRoutine(label int) {
+	c.addInstructionWithLabel(LABEL, label)
+
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(PUSH, HEAP_ADDR)
+	c.addInstruction(SUB)
+	outsidePos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(PUSH, VM_ALLOC_REC)
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(SUB)
+	insidePos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	beyondPos := c.reserveJumpLabel(JUMP)
+
+	insideLabel := c.markJumpLabel()
+	c.confirmJumpLabel(insidePos, insideLabel)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_BLOCK_TABLE)
+	c.addInstruction(RETRIEVE)
+	notBlockPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstruction(RETRIEVE)
+	unmarkedPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	markedPos := c.reserveJumpLabel(JUMP) // marked or free
+
+	unmarkedLabel := c.markJumpLabel()
+	c.confirmJumpLabel(unmarkedPos, unmarkedLabel)
+	c.addInstruction(DUP)
+	c.pushTableAddress(HEAP_MARK_TABLE)
+	c.addInstructionWithArg(PUSH, BLOCK_MARKED)
+	c.addInstruction(STORE)
+
+	// elements up to the length, which is clamped by the block size
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE) // length
+	c.addInstruction(DUP)
+	negativePos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	c.addInstructionWithArg(COPY, 1) // block
+	c.pushTableAddress(HEAP_BLOCK_TABLE)
+	c.addInstruction(RETRIEVE)
+	c.addInstructionWithArg(PUSH, 2)
+	c.addInstruction(SUB) // cells
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(COPY, 2) // length
+	c.addInstruction(SUB)
+	clampPos := c.reserveJumpLabel(JUMP_WHEN_NEGA)
+	c.addInstruction(DISCARD)
+	elementsPos := c.reserveJumpLabel(JUMP)
+
+	clampLabel := c.markJumpLabel()
+	c.confirmJumpLabel(clampPos, clampLabel)
+	c.addInstructionWithArg(SLIDE, 1)
+
+	elementsLabel := c.markJumpLabel()
+	c.confirmJumpLabel(elementsPos, elementsLabel)
+	c.addInstruction(DUP)
+	elementsEndPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstruction(SUB)
+	c.addInstructionWithArg(COPY, 1) // block
+	c.addInstructionWithArg(COPY, 1) // index
+	c.addInstruction(ADD)
+	c.addInstructionWithArg(PUSH, 2)
+	c.addInstruction(ADD)
+	c.addInstruction(RETRIEVE)
+	c.addInstructionWithLabel(CALLSUB, label)
+	c.addInstructionWithLabel(JUMP, elementsLabel)
+
+	elementsEndLabel := c.markJumpLabel()
+	c.confirmJumpLabel(elementsEndPos, elementsEndLabel)
+	c.confirmJumpLabel(negativePos, elementsEndLabel)
+	c.addInstruction(DISCARD)
+
+	doneLabel := c.markJumpLabel()
+	for _, pos := range []int{outsidePos, beyondPos, notBlockPos, markedPos} {
+		c.confirmJumpLabel(pos, doneLabel)
+	}
+	c.addInstruction(DISCARD)
+	c.addInstruction(ENDSUB)
+}
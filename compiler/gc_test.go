@@ -0,0 +1,80 @@
+package compiler
+
+import "testing"
+
+func TestCompileSpillStack(t *testing.T) {
+	input := "func f(a) { f(a); }"
+	instructions := compile(input, t)
+	expects := []string{
+		"TTT",    // end
+		"TFFFT",  // mark label f
+		"FLFFFT", // copy 0 (a)
+
+		// spill a
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
+		"FLFFLFT",                // copy 2 (a)
+		"LLF",                    // store
+
+		// before call
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"FTF",                    // dup
+		"LLL",                    // retrieve
+		"FFFLT",                  // push frame size 1
+		"LFFF",                   // add
+		"LLF",                    // store
+
+		"TFLFT", // call f
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileAllocateWithGC(t *testing.T) {
+	input := "\"a\"; \"b\";"
+	instructions := compile(input, t)
+	expects := []string{
+		"FFFLFFT", // push 4 ( length * 2 + 2 )
+
+		// frame top
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
+		"FFFFT",                  // push frame size 0
+		"LFFF",                   // add
+
+		"FTL",   // swap
+		"TFLFT", // call allocate
+	}
+
+	assertInstructions(instructions, expects, t)
+
+	routines := 0
+	for _, instruction := range instructions {
+		if instruction == "TFFLT" {
+			routines++
+		}
+	}
+	if routines != 1 {
+		t.Fatalf("allocate routine should be emitted once. got=%d", routines)
+	}
+}
+
+func TestAsmCallSpillsStack(t *testing.T) {
+	churn := "func churn() { var i = 0; while (i < 5000) { var t = [i, i, i]; i = i + 1; } return 1; }"
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		// The array held by the enclosing expression.
+		{"func mk() { return [11, 22, 33]; }" + churn + "putn(mk()[asm(out: 1) { call churn; }]);", "22"},
+		// The array pushed by the asm block itself.
+		{"func mk() { return [11, 22, 33]; }" + churn + "putn(asm(out: 1) { call mk; call churn; discard; }[2]);", "33"},
+	}
+
+	for i, tt := range tests {
+		output := execute(decodeInstructions(compile(tt.input, t)), t)
+		if output != tt.expect {
+			t.Fatalf("tests[%d] - output wrong. expected=%q, got=%q", i, tt.expect, output)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package compiler
+
+import "github.com/simomu-github/sfflt_lang/ast"
+
+// inlineFunction is a function declaration measured by the inliner.
+type inlineFunction struct {
+	function ast.Function
+	// cost is the number of statements and expressions in the body.
+	cost    int
+	locals  int
+	callees []string
+	// asmReturn is set when an asm block returns from the function, which
+	// would return from the caller once inlined.
+	asmReturn bool
+	// inlinable is set for small functions which do not reach themselves.
+	inlinable bool
+}
+
+// inlining is the context of a function body compiled at a call site.
+type inlining struct {
+	paramCount      int
+	localBase       int
+	returnPositions []int
+}
+
+// inlineAnalyzer collects the cost and the callees of every function.
+type inlineAnalyzer struct {
+	functions map[string]*inlineFunction
+	current   *inlineFunction
+}
+
+// findInlineFunctions decides which functions are inlined, and reserves the
+// slots for the local variables of inlined bodies in the main frame.
+func (c *Compiler) findInlineFunctions() {
+	main := &inlineFunction{}
+	analyzer := &inlineAnalyzer{functions: map[string]*inlineFunction{}, current: main}
+	for _, stmt := range c.statements {
+		stmt.Visit(analyzer)
+	}
+
+	for name, f := range analyzer.functions {
+		f.inlinable = f.cost <= c.InlineThreshold && !f.asmReturn && !analyzer.reaches(f, name, map[string]bool{})
+	}
+	c.inlineFunctions = analyzer.functions
+
+	c.mainFrame.locals += c.inlineLocals(main)
+}
+
+// inlineLocals returns the number of slots needed by the local variables of
+// the bodies inlined into f, including the ones inlined into them.
+func (c *Compiler) inlineLocals(f *inlineFunction) int {
+	size := 0
+	for _, name := range f.callees {
+		callee := c.inlineFunctions[name]
+		if callee == nil || !callee.inlinable {
+			continue
+		}
+
+		if locals := callee.locals + c.inlineLocals(callee); locals > size {
+			size = locals
+		}
+	}
+
+	return size
+}
+
+// lookupInlineFunction returns the function called by e if it is inlined.
+func (c *Compiler) lookupInlineFunction(e ast.Call) (*inlineFunction, bool) {
+	f, ok := c.inlineFunctions[mangle(e.Module, e.Callee.Literal)]
+	if !ok || !f.inlinable {
+		return nil, false
+	}
+
+	return f, true
+}
+
+// inline compiles the body of f in place of a call whose arguments are on the
+// top of the stack. Arguments are read from the stack as in the function
+// itself, and local variables are moved to the reserved slots of the frame.
+func (c *Compiler) inline(f *inlineFunction) {
+	frame := c.currentFrame()
+	enclosing := c.inlining
+	c.inlining = &inlining{
+		paramCount: len(f.function.Params),
+		localBase:  frame.inlineSlot,
+	}
+	frame.inlineSlot += f.locals
+
+	c.hold(len(f.function.Params))
+	for _, stmt := range f.function.Body {
+		stmt.Visit(c)
+	}
+	c.release(len(f.function.Params))
+
+	c.addInstructionWithArg(PUSH, 0)
+	c.slideParams(len(f.function.Params))
+
+	endLabel := c.markJumpLabel()
+	for _, pos := range c.inlining.returnPositions {
+		c.confirmJumpLabel(pos, endLabel)
+	}
+
+	frame.inlineSlot -= f.locals
+	c.inlining = enclosing
+}
+
+// localSlot converts the slot of a local variable into the slot in the
+// current frame.
+func (c *Compiler) localSlot(slot int) int {
+	if c.inlining == nil {
+		return slot
+	}
+
+	return c.inlining.localBase + slot
+}
+
+// paramCount returns the number of parameters on the stack of the function
+// being compiled or inlined.
+func (c *Compiler) paramCount() int {
+	if c.inlining != nil {
+		return c.inlining.paramCount
+	}
+
+	return c.compilingFunction.ParamCount
+}
+
+// reaches reports whether the function named target is called from f directly
+// or indirectly.
+func (a *inlineAnalyzer) reaches(f *inlineFunction, target string, visited map[string]bool) bool {
+	for _, name := range f.callees {
+		if name == target {
+			return true
+		}
+
+		callee := a.functions[name]
+		if callee == nil || visited[name] {
+			continue
+		}
+		visited[name] = true
+
+		if a.reaches(callee, target, visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *inlineAnalyzer) VisitVar(s ast.Var) {
+	a.current.cost++
+	s.Expression.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitFunction(s ast.Function) {
+	enclosing := a.current
+	a.current = &inlineFunction{function: s, locals: frameSize(s.Body)}
+	a.functions[mangle(s.Module, s.Name.Literal)] = a.current
+
+	for _, stmt := range s.Body {
+		stmt.Visit(a)
+	}
+
+	a.current = enclosing
+}
+
+func (a *inlineAnalyzer) VisitReturn(s ast.Return) {
+	a.current.cost++
+	if s.Value != nil {
+		s.Value.Visit(a)
+	}
+}
+
+func (a *inlineAnalyzer) VisitBreak(s ast.Break) { a.current.cost++ }
+
+func (a *inlineAnalyzer) VisitIf(s ast.If) {
+	a.current.cost++
+	s.Condition.Visit(a)
+	s.Then.Visit(a)
+	if s.Else != nil {
+		s.Else.Visit(a)
+	}
+}
+
+func (a *inlineAnalyzer) VisitWhile(s ast.While) {
+	a.current.cost++
+	s.Condition.Visit(a)
+	s.Body.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitBlock(s ast.Block) {
+	for _, stmt := range s.Statements {
+		stmt.Visit(a)
+	}
+}
+
+func (a *inlineAnalyzer) VisitExpression(s ast.ExpressionStatement) { s.Expression.Visit(a) }
+
+func (a *inlineAnalyzer) VisitAssert(s ast.Assert) {
+	a.current.cost++
+	s.Condition.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitAsmStatement(s ast.AsmStatement) { a.VisitAsm(s.Asm) }
+
+func (a *inlineAnalyzer) VisitAssign(e ast.Assign) {
+	a.current.cost++
+	if index, ok := e.Target.(ast.Index); ok {
+		index.Receiver.Visit(a)
+		index.Index.Visit(a)
+	}
+	e.Expression.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitBinaryExpression(e ast.Binary) {
+	a.current.cost++
+	e.Left.Visit(a)
+	e.Right.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitUnaryExpression(e ast.Unary) {
+	a.current.cost++
+	e.Right.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitCall(e ast.Call) {
+	a.current.cost++
+	for _, arg := range e.Arguments {
+		arg.Visit(a)
+	}
+
+	if _, ok := lookupBuildinFunction(e); !ok {
+		a.current.callees = append(a.current.callees, mangle(e.Module, e.Callee.Literal))
+	}
+}
+
+func (a *inlineAnalyzer) VisitIntegerLiteral(e ast.IntegerLiteral) { a.current.cost++ }
+func (a *inlineAnalyzer) VisitCharLiteral(e ast.CharLiteral)       { a.current.cost++ }
+func (a *inlineAnalyzer) VisitStringLiteral(e ast.StringLiteral)   { a.current.cost++ }
+func (a *inlineAnalyzer) VisitBooleanLiteral(e ast.BooleanLiteral) { a.current.cost++ }
+func (a *inlineAnalyzer) VisitVariable(e ast.Variable)             { a.current.cost++ }
+
+func (a *inlineAnalyzer) VisitArrayLiteral(e ast.ArrayLiteral) {
+	a.current.cost++
+	for _, element := range e.Elements {
+		element.Visit(a)
+	}
+}
+
+func (a *inlineAnalyzer) VisitIndex(e ast.Index) {
+	a.current.cost++
+	e.Receiver.Visit(a)
+	e.Index.Visit(a)
+}
+
+func (a *inlineAnalyzer) VisitAsm(e ast.Asm) {
+	a.current.cost += len(e.Instructions)
+	for _, instruction := range e.Instructions {
+		switch instruction.Mnemonic.Literal {
+		case mnemonics[CALLSUB]:
+			a.current.callees = append(a.current.callees, mangle(e.Module, instruction.Operand.Literal))
+		case mnemonics[ENDSUB]:
+			a.current.asmReturn = true
+		}
+	}
+}
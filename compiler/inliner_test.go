@@ -0,0 +1,69 @@
+package compiler
+
+import "testing"
+
+func TestCompileInline(t *testing.T) {
+	input := "func f(a) { return a + 1; } f(2);"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.InlineThreshold = 10 }, t)
+	expects := []string{
+		"FFFLFT", // push 2
+
+		// inlined f
+		"FLFFFT", // copy 0 (a)
+		"FFFLT",  // push 1
+		"LFFF",   // add
+		"FLTFLT", // slide 1
+		"TFTLT",  // jump end
+		"FFFFT",  // push 0
+		"FLTFLT", // slide 1
+		"TFFLT",  // mark label end
+
+		"FTT", // discard
+		"TTT", // end
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileInlineLocalVariable(t *testing.T) {
+	input := "func f() { var a = 1; } { var b = 2; f(); }"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.InlineThreshold = 10 }, t)
+	expects := []string{
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
+		"FFFLFT",                 // push 2
+		"LLF",                    // store b
+
+		// inlined f
+		"FFFLFFFFFFFFFFFFFFFFFT", // push frame pointer address
+		"LLL",                    // retrieve
+		"FFFLT",                  // push slot 1
+		"LFFF",                   // add
+		"FFFLT",                  // push 1
+		"LLF",                    // store a
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileInlineRecursion(t *testing.T) {
+	input := "func f(a) { return g(a); } func g(a) { return f(a); } f(1);"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.InlineThreshold = 10 }, t)
+	expects := []string{
+		"FFFLT", // push 1
+		"TFLFT", // call f
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileInlineThreshold(t *testing.T) {
+	input := "func f(a) { return a + 1; } f(2);"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.InlineThreshold = 3 }, t)
+	expects := []string{
+		"FFFLFT", // push 2
+		"TFLFT",  // call f
+	}
+
+	assertInstructions(instructions, expects, t)
+}
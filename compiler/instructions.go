@@ -36,10 +36,43 @@ const (
 const (
 	POSI = "F"
 	NEGA = "L"
-
-	ZERO      = "FF"
-	ONE       = "FL"
-	MINUS_ONE = "LL"
 )
 
 type InstructionType string
+
+// Instruction is an instruction before it is encoded into FFLT.
+type Instruction struct {
+	Op InstructionType
+	// Arg is the number of PUSH, COPY and SLIDE.
+	Arg int64
+	// Label is the label marked by LABEL, or jumped to by the jumps and
+	// CALLSUB.
+	Label int
+	// SourcePos is the position of the source the instruction is compiled
+	// from. It is zero for the runtime routines.
+	SourcePos SourcePos
+}
+
+type SourcePos struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+// noLabel is the label of jumps until their labels are confirmed, and of the
+// runtime routines which are not used.
+const noLabel = -1
+
+// HasArg reports whether the instruction takes a number.
+func (op InstructionType) HasArg() bool {
+	return op == PUSH || op == COPY || op == SLIDE
+}
+
+// HasLabel reports whether the instruction takes a label.
+func (op InstructionType) HasLabel() bool {
+	return op == LABEL || isJump(op)
+}
+
+func isJump(op InstructionType) bool {
+	return op == JUMP || op == JUMP_WHEN_ZERO || op == JUMP_WHEN_NEGA || op == CALLSUB
+}
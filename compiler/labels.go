@@ -0,0 +1,81 @@
+package compiler
+
+import "sort"
+
+// compactLabels threads jumps to unconditional jumps through to their final
+// targets, removes the labels which are never jumped to, and renumbers the
+// remaining labels so that the most used ones get the shortest encodings.
+func compactLabels(instructions []Instruction) []Instruction {
+	labels := map[int]int{}
+	for i, instruction := range instructions {
+		if instruction.Op == LABEL {
+			labels[instruction.Label] = i
+		}
+	}
+
+	references := map[int]int{}
+	for i, instruction := range instructions {
+		if !isJump(instruction.Op) {
+			continue
+		}
+
+		target := threadJump(instructions, labels, instruction.Label)
+		instructions[i].Label = target
+		references[target]++
+	}
+
+	compacted := []Instruction{}
+	order := []int{}
+	for _, instruction := range instructions {
+		if instruction.Op == LABEL {
+			if references[instruction.Label] == 0 {
+				continue
+			}
+			order = append(order, instruction.Label)
+		}
+		compacted = append(compacted, instruction)
+	}
+
+	// Labels used equally often keep the order they are marked in.
+	sort.SliceStable(order, func(i, j int) bool {
+		return references[order[i]] > references[order[j]]
+	})
+	renamed := map[int]int{}
+	for i, label := range order {
+		renamed[label] = i
+	}
+
+	for i, instruction := range compacted {
+		if label, ok := renamed[instruction.Label]; ok && instruction.Op.HasLabel() {
+			compacted[i].Label = label
+		}
+	}
+
+	return compacted
+}
+
+// threadJump follows the unconditional jumps found right after label, and
+// returns the label where they end. Jumps going around in a loop stop at the
+// label first met again.
+func threadJump(instructions []Instruction, labels map[int]int, label int) int {
+	visited := map[int]bool{}
+	for !visited[label] {
+		visited[label] = true
+
+		pos, ok := labels[label]
+		if !ok {
+			return label
+		}
+
+		next := pos + 1
+		for next < len(instructions) && instructions[next].Op == LABEL {
+			next++
+		}
+		if next == len(instructions) || instructions[next].Op != JUMP {
+			return label
+		}
+		label = instructions[next].Label
+	}
+
+	return label
+}
@@ -0,0 +1,81 @@
+package compiler
+
+import "testing"
+
+func TestCompactLabelsThreadJumps(t *testing.T) {
+	input := []string{
+		"TFFLFLT", // mark label 5
+		"TFTLLFT", // jump 6
+		"TFFLLFT", // mark label 6
+		"TFTLLLT", // jump 7
+		"TFFLLLT", // mark label 7
+		"TLFLLFT", // jump 6 when zero
+		"TTT",     // end
+	}
+	expects := []string{
+		"TFTFT", // jump 0
+		"TFTFT", // jump 0
+		"TFFFT", // mark label 0
+		"TLFFT", // jump 0 when zero
+		"TTT",   // end
+	}
+
+	assertCompactLabels(input, expects, t)
+}
+
+func TestCompactLabelsRenumber(t *testing.T) {
+	input := []string{
+		"TFFFT",  // mark label 0
+		"TFFLT",  // mark label 1
+		"TFFLFT", // mark label 2
+		"TFLFT",  // call 0
+		"TLLLFT", // jump 2 when negative
+		"TLLLFT", // jump 2 when negative
+		"TLFLFT", // jump 2 when zero
+		"TFTLT",  // jump 1
+		"TTT",    // end
+	}
+	expects := []string{
+		"TFFLT",  // mark label 1
+		"TFFLFT", // mark label 2
+		"TFFFT",  // mark label 0
+		"TFLLT",  // call 1
+		"TLLFT",  // jump 0 when negative
+		"TLLFT",  // jump 0 when negative
+		"TLFFT",  // jump 0 when zero
+		"TFTLFT", // jump 2
+		"TTT",    // end
+	}
+
+	assertCompactLabels(input, expects, t)
+}
+
+func TestCompactLabelsJumpLoop(t *testing.T) {
+	input := []string{
+		"TFFFT", // mark label 0
+		"TFTLT", // jump 1
+		"TFFLT", // mark label 1
+		"TFTFT", // jump 0
+	}
+	expects := []string{
+		"TFFFT", // mark label 0
+		"TFTLT", // jump 1
+		"TFFLT", // mark label 1
+		"TFTFT", // jump 0
+	}
+
+	assertCompactLabels(input, expects, t)
+}
+
+func assertCompactLabels(input []string, expects []string, t *testing.T) {
+	actuals := Encode(compactLabels(decodeInstructions(input)))
+
+	if len(actuals) != len(expects) {
+		t.Fatalf("instruction length wrong. expected=%q, got=%q", expects, actuals)
+	}
+	for i, expect := range expects {
+		if actuals[i] != expect {
+			t.Fatalf("tests[%d] - instruction wrong. expected=%q, got=%q", i, expect, actuals[i])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mnemonics are the names of the instructions in assembly.
+var mnemonics = map[InstructionType]string{
+	PUSH:    "push",
+	DUP:     "dup",
+	SWAP:    "swap",
+	DISCARD: "discard",
+	COPY:    "copy",
+	SLIDE:   "slide",
+
+	ADD: "add",
+	SUB: "sub",
+	MUL: "mul",
+	DIV: "div",
+	MOD: "mod",
+
+	STORE:    "store",
+	RETRIEVE: "retrieve",
+
+	GETC: "getc",
+	GETN: "getn",
+	PUTC: "putc",
+	PUTN: "putn",
+
+	LABEL:          "label",
+	JUMP:           "jump",
+	JUMP_WHEN_ZERO: "jz",
+	JUMP_WHEN_NEGA: "jn",
+
+	CALLSUB: "call",
+	ENDSUB:  "ret",
+
+	END: "end",
+}
+
+// Mnemonic returns the name of the instruction in assembly.
+func (op InstructionType) Mnemonic() string {
+	return mnemonics[op]
+}
+
+// Listing writes instructions as assembly, one instruction per line with its
+// offset in a comment. labelName names the labels.
+func Listing(instructions []Instruction, labelName func(label int) string) string {
+	var out strings.Builder
+	for i, instruction := range instructions {
+		text := instruction.Op.Mnemonic()
+		switch {
+		case instruction.Op.HasArg():
+			text += fmt.Sprintf(" %d", instruction.Arg)
+		case instruction.Op.HasLabel():
+			text += " " + labelName(instruction.Label)
+		}
+		if instruction.Op != LABEL {
+			text = "  " + text
+		}
+		fmt.Fprintf(&out, "%-20s // %d\n", text, i)
+	}
+
+	return out.String()
+}
+
+// LookupMnemonic returns the instruction named mnemonic in assembly.
+func LookupMnemonic(mnemonic string) (InstructionType, bool) {
+	for op, name := range mnemonics {
+		if name == mnemonic {
+			return op, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+)
+
+type OptimizationLevel int
+
+const (
+	// O0 compiles the program as written.
+	O0 OptimizationLevel = iota
+	// O1 folds constants and eliminates dead code.
+	O1
+	// O2 enables every optimization.
+	O2
+	// Os enables the optimizations which do not grow the output.
+	Os
+)
+
+// levelPasses lists the passes and the code generation options, inline and
+// branch-conditions, enabled at each level.
+var levelPasses = map[OptimizationLevel][]string{
+	O0: {},
+	O1: {"constant-folding", "dead-code"},
+	O2: {"constant-folding", "dead-code", "inline", "branch-conditions", "peephole", "compact-labels"},
+	Os: {"constant-folding", "dead-code", "branch-conditions", "peephole", "compact-labels"},
+}
+
+// PassManager runs the passes over the statements before compiling and over
+// the instructions after compiling, in the order they are registered.
+type PassManager struct {
+	passes  []pass
+	enabled map[string]bool
+	// PrintAfter names the pass after which the program is printed.
+	PrintAfter string
+	Output     io.Writer
+}
+
+// pass rewrites either the statements or the instructions.
+type pass struct {
+	name         string
+	statements   func(c *Compiler, statements []ast.Statement) []ast.Statement
+	instructions func(c *Compiler, instructions []Instruction) []Instruction
+}
+
+// NewPassManager registers the passes of the compiler, and enables the ones
+// of the level.
+func NewPassManager(level OptimizationLevel) *PassManager {
+	m := &PassManager{enabled: map[string]bool{}, Output: os.Stdout}
+
+	m.RegisterASTPass("constant-folding", func(c *Compiler, statements []ast.Statement) []ast.Statement {
+		return NewConstantFolder(statements).Fold()
+	})
+	m.RegisterASTPass("dead-code", func(c *Compiler, statements []ast.Statement) []ast.Statement {
+		return NewDeadCodeEliminator(statements).Eliminate()
+	})
+	m.RegisterInstructionPass("peephole", func(c *Compiler, instructions []Instruction) []Instruction {
+		return c.peephole(instructions)
+	})
+	m.RegisterInstructionPass("compact-labels", func(c *Compiler, instructions []Instruction) []Instruction {
+		return compactLabels(instructions)
+	})
+
+	for _, name := range levelPasses[level] {
+		m.enabled[name] = true
+	}
+
+	return m
+}
+
+func (m *PassManager) RegisterASTPass(name string, run func(c *Compiler, statements []ast.Statement) []ast.Statement) {
+	m.passes = append(m.passes, pass{name: name, statements: run})
+}
+
+func (m *PassManager) RegisterInstructionPass(name string, run func(c *Compiler, instructions []Instruction) []Instruction) {
+	m.passes = append(m.passes, pass{name: name, instructions: run})
+}
+
+func (m *PassManager) SetEnabled(name string, enabled bool) { m.enabled[name] = enabled }
+func (m *PassManager) Enabled(name string) bool             { return m.enabled[name] }
+
+// HasPass reports whether a pass named name is registered.
+func (m *PassManager) HasPass(name string) bool {
+	for _, p := range m.passes {
+		if p.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *PassManager) runStatements(c *Compiler, statements []ast.Statement) []ast.Statement {
+	for _, p := range m.passes {
+		if p.statements == nil || !m.enabled[p.name] {
+			continue
+		}
+
+		statements = p.statements(c, statements)
+		if p.name == m.PrintAfter {
+			fmt.Fprintf(m.Output, "// after %s\n%s", p.name, printStatements(statements))
+		}
+	}
+
+	return statements
+}
+
+func (m *PassManager) runInstructions(c *Compiler, instructions []Instruction) []Instruction {
+	for _, p := range m.passes {
+		if p.instructions == nil || !m.enabled[p.name] {
+			continue
+		}
+
+		instructions = p.instructions(c, instructions)
+		if p.name == m.PrintAfter {
+			fmt.Fprintf(m.Output, "// after %s\n%s", p.name, Listing(instructions, func(label int) string {
+				return fmt.Sprintf("L%d", label)
+			}))
+		}
+	}
+
+	return instructions
+}
@@ -0,0 +1,102 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPassManagerLevels(t *testing.T) {
+	tests := []struct {
+		level   OptimizationLevel
+		pass    string
+		enabled bool
+	}{
+		{O0, "constant-folding", false},
+		{O1, "constant-folding", true},
+		{O1, "dead-code", true},
+		{O1, "peephole", false},
+		{O2, "inline", true},
+		{O2, "compact-labels", true},
+		{Os, "inline", false},
+		{Os, "peephole", true},
+	}
+
+	for i, tt := range tests {
+		if enabled := NewPassManager(tt.level).Enabled(tt.pass); enabled != tt.enabled {
+			t.Fatalf("tests[%d] - %s enabled wrong. expected=%t, got=%t", i, tt.pass, tt.enabled, enabled)
+		}
+	}
+}
+
+func TestPassManagerDisablePass(t *testing.T) {
+	input := "putn(1 + 2);"
+	passes := NewPassManager(O1)
+	passes.SetEnabled("constant-folding", false)
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Passes = passes }, t)
+	expects := []string{
+		"FFFLT",  // push 1
+		"FFFLFT", // push 2
+		"LFFF",   // add
+		"LTFL",   // putn
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestPassManagerInstructionPass(t *testing.T) {
+	input := "putn(3);"
+	passes := NewPassManager(O0)
+	passes.RegisterInstructionPass("end", func(c *Compiler, instructions []Instruction) []Instruction {
+		return append(instructions, Instruction{Op: END})
+	})
+	passes.SetEnabled("end", true)
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Passes = passes }, t)
+	expects := []string{
+		"FFFLLT", // push 3
+		"LTFL",   // putn
+		"FFFFT",  // push 0
+		"FTT",    // discard
+		"TTT",    // end
+		"TTT",    // end
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestPassManagerPrintAfter(t *testing.T) {
+	input := "var a = 60 * 60; func f() { return a; } putn(a);"
+	out := &bytes.Buffer{}
+	passes := NewPassManager(O1)
+	passes.PrintAfter = "dead-code"
+	passes.Output = out
+	compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Passes = passes }, t)
+
+	expects := "// after dead-code\nputn(3600);\n"
+	if out.String() != expects {
+		t.Fatalf("printed program wrong. expected=%q, got=%q", expects, out.String())
+	}
+}
+
+func TestPassManagerPrintAfterInstructionPass(t *testing.T) {
+	input := "putn(3);"
+	out := &bytes.Buffer{}
+	passes := NewPassManager(Os)
+	passes.PrintAfter = "peephole"
+	passes.Output = out
+	compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Passes = passes }, t)
+
+	expects := `// after peephole
+  push 65536         // 0
+  push 25769803776   // 1
+  store              // 2
+  push 131072        // 3
+  push 17179869184   // 4
+  store              // 5
+  push 3             // 6
+  putn               // 7
+  end                // 8
+`
+	if out.String() != expects {
+		t.Fatalf("printed program wrong. expected=%q, got=%q", expects, out.String())
+	}
+}
@@ -0,0 +1,205 @@
+package compiler
+
+// peephole rewrites wasteful instruction sequences until none is left.
+// Labels which are jumped to are kept, so every jump keeps its target.
+func (c *Compiler) peephole(instructions []Instruction) []Instruction {
+	// labels added by the optimizer, which are removed once unused
+	created := map[int]bool{}
+	for {
+		optimized, changed := c.peepholePass(instructions, created)
+		instructions = optimized
+		if !changed {
+			return instructions
+		}
+	}
+}
+
+func (c *Compiler) peepholePass(instructions []Instruction, created map[int]bool) ([]Instruction, bool) {
+	references := map[int]int{}
+	labels := map[int]int{}
+	for i, instruction := range instructions {
+		if isJump(instruction.Op) {
+			references[instruction.Label]++
+		} else if instruction.Op == LABEL {
+			labels[instruction.Label] = i
+		}
+	}
+
+	// branches following a label, which constant conditions jump over
+	skipLabels := map[int]int{}
+	skipLabel := func(branch int) int {
+		if label, ok := skipLabels[branch]; ok {
+			return label
+		}
+		skipLabels[branch] = c.newLabel()
+		created[skipLabels[branch]] = true
+		return skipLabels[branch]
+	}
+
+	removed := make([]bool, len(instructions))
+	changed := false
+	remove := func(positions ...int) {
+		for _, pos := range positions {
+			removed[pos] = true
+		}
+		changed = true
+	}
+
+	for i := 0; i < len(instructions); i++ {
+		if removed[i] {
+			continue
+		}
+		op := instructions[i].Op
+
+		next := i + 1
+		for next < len(instructions) && removed[next] {
+			next++
+		}
+		if next == len(instructions) {
+			break
+		}
+		nextOp := instructions[next].Op
+
+		switch {
+		// values which are discarded right away
+		case (op == PUSH || op == DUP || op == COPY) && nextOp == DISCARD:
+			remove(i, next)
+		case op == RETRIEVE && nextOp == DISCARD:
+			remove(i)
+		// assignments whose value is discarded
+		case op == STORE && nextOp == DISCARD:
+			if dup, copies := storedDup(instructions, removed, i); dup >= 0 {
+				for _, pos := range copies {
+					instructions[pos].Arg--
+				}
+				remove(dup, next)
+			}
+		// branches on constants
+		case op == PUSH && (nextOp == JUMP_WHEN_ZERO || nextOp == JUMP_WHEN_NEGA):
+			if branchTaken(nextOp, instructions[i].Arg) {
+				instructions[next].Op = JUMP
+				remove(i)
+			} else {
+				remove(i, next)
+			}
+		// constants tested right after the label jumped to, or fallen into
+		case op == PUSH && (nextOp == JUMP || nextOp == LABEL):
+			at, ok := labels[instructions[next].Label]
+			branch := at + 1
+			if !ok || branch >= len(instructions) || removed[branch] {
+				continue
+			}
+			branchOp := instructions[branch].Op
+			if branchOp != JUMP_WHEN_ZERO && branchOp != JUMP_WHEN_NEGA {
+				continue
+			}
+
+			target := instructions[branch].Label
+			if !branchTaken(branchOp, instructions[i].Arg) {
+				target = skipLabel(branch)
+			}
+			instructions[i] = Instruction{Op: JUMP, Label: target, SourcePos: instructions[i].SourcePos}
+			if nextOp == JUMP {
+				remove(next)
+			}
+			changed = true
+		case op == LABEL && created[instructions[i].Label] && references[instructions[i].Label] == 0:
+			remove(i)
+		// jumps to the next instruction
+		case op == JUMP && nextOp == LABEL && instructions[next].Label == instructions[i].Label:
+			remove(i)
+		// unreachable instructions after unconditional transfers
+		case op == JUMP || op == ENDSUB || op == END:
+			for j := next; j < len(instructions); j++ {
+				if instructions[j].Op == LABEL && references[instructions[j].Label] != 0 {
+					break
+				}
+				if !removed[j] {
+					remove(j)
+				}
+			}
+		}
+	}
+
+	optimized := []Instruction{}
+	for i, instruction := range instructions {
+		if !removed[i] {
+			optimized = append(optimized, instruction)
+		}
+		if label, ok := skipLabels[i]; ok {
+			optimized = append(optimized, Instruction{Op: LABEL, Label: label, SourcePos: instruction.SourcePos})
+		}
+	}
+
+	return optimized, changed
+}
+
+func branchTaken(op InstructionType, value int64) bool {
+	if op == JUMP_WHEN_ZERO {
+		return value == 0
+	}
+	return value < 0
+}
+
+// storedDup returns the position of the DUP which pushed the address stored
+// by the STORE at pos, or -1 if it is not found in the straight code before.
+// Without the DUP, the STORE consumes the address left for the DISCARD, and
+// the COPY instructions in between reading below the address reach one less.
+func storedDup(instructions []Instruction, removed []bool, pos int) (int, []int) {
+	copies := []int{}
+	depth := 1 // address below the value
+	for i := pos - 1; i >= 0; i-- {
+		if removed[i] {
+			continue
+		}
+
+		switch instructions[i].Op {
+		case DUP:
+			if depth == 0 {
+				return i, copies
+			}
+			if depth == 1 {
+				return -1, nil
+			}
+			depth--
+		case PUSH:
+			if depth == 0 {
+				return -1, nil
+			}
+			depth--
+		case COPY:
+			if depth == 0 {
+				return -1, nil
+			}
+			depth--
+			if int(instructions[i].Arg) > depth {
+				copies = append(copies, i)
+			}
+		case SWAP:
+			if depth < 2 {
+				depth = 1 - depth
+			}
+		case SLIDE:
+			if depth != 0 {
+				depth += int(instructions[i].Arg)
+			}
+		case ADD, SUB, MUL, DIV, MOD:
+			if depth == 0 {
+				return -1, nil
+			}
+			depth++
+		case RETRIEVE:
+			if depth == 0 {
+				return -1, nil
+			}
+		case DISCARD, PUTC, PUTN, GETC, GETN:
+			depth++
+		case STORE:
+			depth += 2
+		default:
+			return -1, nil
+		}
+	}
+
+	return -1, nil
+}
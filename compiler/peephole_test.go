@@ -0,0 +1,107 @@
+package compiler
+
+import "testing"
+
+func TestPeepholeDiscardedValues(t *testing.T) {
+	input := []string{
+		"FFFLT", // push 1
+		"FTT",   // discard
+		"FTF",   // dup
+		"FTT",   // discard
+		"LLL",   // retrieve
+		"FTT",   // discard
+		"TTT",   // end
+	}
+	expects := []string{
+		"FTT", // discard
+		"TTT", // end
+	}
+
+	assertPeephole(input, expects, t)
+}
+
+func TestPeepholeAssignmentStatement(t *testing.T) {
+	input := []string{
+		"FFFLFT",  // push a
+		"FTF",     // dup
+		"FLFFLFT", // copy 2 (argument)
+		"FFFLT",   // push 1
+		"LFFF",    // add
+		"LLF",     // store
+		"LLL",     // retrieve
+		"FTT",     // discard
+		"TTT",     // end
+	}
+	expects := []string{
+		"FFFLFT", // push a
+		"FLFFLT", // copy 1 (argument)
+		"FFFLT",  // push 1
+		"LFFF",   // add
+		"LLF",    // store
+		"TTT",    // end
+	}
+
+	assertPeephole(input, expects, t)
+}
+
+func TestPeepholeConstantBranch(t *testing.T) {
+	input := []string{
+		"FFFLT",  // push 1
+		"TLFLT",  // jump 1 when zero
+		"FFFFT",  // push 0
+		"TLFFT",  // jump 0 when zero
+		"FFFLLT", // push 3
+		"TFFLT",  // mark label 1
+		"TFFFT",  // mark label 0
+		"TTT",    // end
+	}
+	expects := []string{
+		"TFFFT", // mark label 0
+		"TTT",   // end
+	}
+
+	assertPeephole(input, expects, t)
+}
+
+func TestPeepholeMaterializedBoolean(t *testing.T) {
+	// if (a < b) ...
+	input := []string{
+		"LFFL",   // sub
+		"TLLFT",  // jump 0 when negative
+		"FFFFT",  // push 0
+		"TFTLT",  // jump 1
+		"TFFFT",  // mark label 0
+		"FFFLT",  // push 1
+		"TFFLT",  // mark label 1
+		"TLFLFT", // jump 2 when zero
+		"LTFL",   // putn
+		"TFFLFT", // mark label 2
+		"TTT",    // end
+	}
+	expects := []string{
+		"LFFL",   // sub
+		"TLLFT",  // jump 0 when negative
+		"TFTLFT", // jump 2
+		"TFFFT",  // mark label 0
+		"LTFL",   // putn
+		"TFFLFT", // mark label 2
+		"TTT",    // end
+	}
+
+	assertPeephole(input, expects, t)
+}
+
+func assertPeephole(input []string, expects []string, t *testing.T) {
+	compiler := New(nil)
+	compiler.labelIndex = 8
+	actuals := Encode(compiler.peephole(decodeInstructions(input)))
+
+	if len(actuals) != len(expects) {
+		t.Fatalf("instruction length wrong. expected=%q, got=%q", expects, actuals)
+	}
+	for i, expect := range expects {
+		if actuals[i] != expect {
+			t.Fatalf("tests[%d] - instruction wrong. expected=%q, got=%q", i, expect, actuals[i])
+		}
+	}
+}
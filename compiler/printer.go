@@ -0,0 +1,307 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+)
+
+// printer writes statements back as source code, so that the program
+// rewritten by the passes over the AST can be read.
+type printer struct {
+	out    strings.Builder
+	indent int
+}
+
+func printStatements(statements []ast.Statement) string {
+	p := &printer{}
+	for _, stmt := range statements {
+		stmt.Visit(p)
+	}
+
+	return p.out.String()
+}
+
+func (p *printer) line(format string, args ...interface{}) {
+	p.out.WriteString(strings.Repeat("  ", p.indent))
+	fmt.Fprintf(&p.out, format, args...)
+	p.out.WriteString("\n")
+}
+
+// body prints the statement of an if or while statement indented, and the
+// statements of a block in place of the block.
+func (p *printer) body(stmt ast.Statement) {
+	p.indent++
+	if block, ok := stmt.(ast.Block); ok {
+		for _, stmt := range block.Statements {
+			stmt.Visit(p)
+		}
+	} else {
+		stmt.Visit(p)
+	}
+	p.indent--
+}
+
+func (p *printer) VisitVar(s ast.Var) {
+	if s.Type != nil {
+		p.line("var %s: %s = %s;", s.Identifier.Literal, s.Type, printExpression(s.Expression))
+		return
+	}
+	p.line("var %s = %s;", s.Identifier.Literal, printExpression(s.Expression))
+}
+
+func (p *printer) VisitFunction(s ast.Function) {
+	params := []string{}
+	for i, param := range s.Params {
+		if i < len(s.ParamTypes) && s.ParamTypes[i] != nil {
+			params = append(params, param.Literal+": "+s.ParamTypes[i].String())
+		} else {
+			params = append(params, param.Literal)
+		}
+	}
+
+	signature := fmt.Sprintf("func %s(%s)", s.Name.Literal, strings.Join(params, ", "))
+	if s.ReturnType != nil {
+		signature += ": " + s.ReturnType.String()
+	}
+	if s.Exported {
+		signature = "export " + signature
+	}
+
+	p.line("%s {", signature)
+	p.indent++
+	for _, stmt := range s.Body {
+		stmt.Visit(p)
+	}
+	p.indent--
+	p.line("}")
+}
+
+func (p *printer) VisitReturn(s ast.Return) {
+	if s.Value == nil {
+		p.line("return;")
+		return
+	}
+	p.line("return %s;", printExpression(s.Value))
+}
+
+func (p *printer) VisitBreak(s ast.Break) { p.line("break;") }
+
+func (p *printer) VisitIf(s ast.If) {
+	p.line("if (%s) {", printExpression(s.Condition))
+	p.body(s.Then)
+	if s.Else != nil {
+		p.line("} else {")
+		p.body(s.Else)
+	}
+	p.line("}")
+}
+
+func (p *printer) VisitWhile(s ast.While) {
+	p.line("while (%s) {", printExpression(s.Condition))
+	p.body(s.Body)
+	p.line("}")
+}
+
+func (p *printer) VisitBlock(s ast.Block) {
+	p.line("{")
+	p.indent++
+	for _, stmt := range s.Statements {
+		stmt.Visit(p)
+	}
+	p.indent--
+	p.line("}")
+}
+
+func (p *printer) VisitExpression(s ast.ExpressionStatement) {
+	p.line("%s;", printExpression(s.Expression))
+}
+
+func (p *printer) VisitAssert(s ast.Assert) {
+	if s.Message == "" {
+		p.line("assert(%s);", printExpression(s.Condition))
+		return
+	}
+	p.line("assert(%s, %s);", printExpression(s.Condition), quote(s.Message, '"'))
+}
+
+func (p *printer) VisitAsmStatement(s ast.AsmStatement) {
+	p.line("%s {", asmHeader(s.Asm))
+	p.indent++
+	for _, instruction := range s.Asm.Instructions {
+		p.line("%s;", asmInstruction(instruction))
+	}
+	p.indent--
+	p.line("}")
+}
+
+// expressionPrinter writes an expression with the operations used as
+// operands in parentheses, so that the order of evaluation is shown as parsed.
+type expressionPrinter struct {
+	out    strings.Builder
+	nested bool
+}
+
+func printExpression(e ast.Expression) string {
+	p := &expressionPrinter{}
+	e.Visit(p)
+	return p.out.String()
+}
+
+// operand writes an operand of an operation.
+func (p *expressionPrinter) operand(e ast.Expression) {
+	nested := p.nested
+	p.nested = true
+	e.Visit(p)
+	p.nested = nested
+}
+
+// enclosed writes an expression enclosed by brackets or the argument list of
+// a call, which needs no parentheses.
+func (p *expressionPrinter) enclosed(e ast.Expression) {
+	nested := p.nested
+	p.nested = false
+	e.Visit(p)
+	p.nested = nested
+}
+
+func (p *expressionPrinter) open() {
+	if p.nested {
+		p.out.WriteString("(")
+	}
+}
+
+func (p *expressionPrinter) close() {
+	if p.nested {
+		p.out.WriteString(")")
+	}
+}
+
+func (p *expressionPrinter) VisitAssign(e ast.Assign) {
+	p.open()
+	if target, ok := e.Target.(ast.Expression); ok {
+		p.enclosed(target)
+	}
+	p.out.WriteString(" = ")
+	p.enclosed(e.Expression)
+	p.close()
+}
+
+func (p *expressionPrinter) VisitBinaryExpression(e ast.Binary) {
+	p.open()
+	p.operand(e.Left)
+	p.out.WriteString(" " + e.Operator.Literal + " ")
+	p.operand(e.Right)
+	p.close()
+}
+
+func (p *expressionPrinter) VisitUnaryExpression(e ast.Unary) {
+	p.out.WriteString(e.Operator.Literal)
+	p.operand(e.Right)
+}
+
+func (p *expressionPrinter) VisitCall(e ast.Call) {
+	if e.IsQualified() {
+		p.out.WriteString(e.Namespace.Literal + ".")
+	}
+	p.out.WriteString(e.Callee.Literal + "(")
+	for i, arg := range e.Arguments {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.enclosed(arg)
+	}
+	p.out.WriteString(")")
+}
+
+func (p *expressionPrinter) VisitIntegerLiteral(e ast.IntegerLiteral) {
+	fmt.Fprintf(&p.out, "%d", e.Value)
+}
+
+func (p *expressionPrinter) VisitCharLiteral(e ast.CharLiteral) {
+	p.out.WriteString(quote(e.Value, '\''))
+}
+
+func (p *expressionPrinter) VisitBooleanLiteral(e ast.BooleanLiteral) {
+	fmt.Fprintf(&p.out, "%t", e.Value)
+}
+
+func (p *expressionPrinter) VisitVariable(e ast.Variable) {
+	p.out.WriteString(e.Identifier.Literal)
+}
+
+func (p *expressionPrinter) VisitArrayLiteral(e ast.ArrayLiteral) {
+	p.out.WriteString("[")
+	for i, element := range e.Elements {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.enclosed(element)
+	}
+	p.out.WriteString("]")
+}
+
+func (p *expressionPrinter) VisitStringLiteral(e ast.StringLiteral) {
+	p.out.WriteString(quote(e.Value, '"'))
+}
+
+func (p *expressionPrinter) VisitIndex(e ast.Index) {
+	p.operand(e.Receiver)
+	p.out.WriteString("[")
+	p.enclosed(e.Index)
+	p.out.WriteString("]")
+}
+
+func (p *expressionPrinter) VisitAsm(e ast.Asm) {
+	p.out.WriteString(asmHeader(e) + " {")
+	for _, instruction := range e.Instructions {
+		p.out.WriteString(" " + asmInstruction(instruction) + ";")
+	}
+	p.out.WriteString(" }")
+}
+
+// asmHeader writes the stack effect of an asm block without the counts which
+// are zero.
+func asmHeader(a ast.Asm) string {
+	effect := []string{}
+	if a.In != 0 {
+		effect = append(effect, fmt.Sprintf("in: %d", a.In))
+	}
+	if a.Out != 0 {
+		effect = append(effect, fmt.Sprintf("out: %d", a.Out))
+	}
+
+	if len(effect) == 0 {
+		return "asm"
+	}
+	return "asm(" + strings.Join(effect, ", ") + ")"
+}
+
+func asmInstruction(instruction ast.AsmInstruction) string {
+	if instruction.Operand.Type == "" {
+		return instruction.Mnemonic.Literal
+	}
+
+	return instruction.Mnemonic.Literal + " " + instruction.Operand.Literal
+}
+
+// quote encloses a literal in quotes, writing the characters which have
+// escape sequences in the lexer as the escape sequences.
+func quote(value string, quotation byte) string {
+	escapes := map[byte]string{
+		0: `\0`, 7: `\a`, 8: `\b`, 9: `\t`, 10: `\n`, 11: `\v`, 12: `\f`, 13: `\r`,
+		'\\': `\\`, quotation: `\` + string(quotation),
+	}
+
+	quoted := string(quotation)
+	for i := 0; i < len(value); i++ {
+		if escape, ok := escapes[value[i]]; ok {
+			quoted += escape
+		} else {
+			quoted += string(value[i])
+		}
+	}
+
+	return quoted + string(quotation)
+}
@@ -0,0 +1,77 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/simomu-github/sfflt_lang/lexer"
+	"github.com/simomu-github/sfflt_lang/parser"
+)
+
+func TestPrintStatements(t *testing.T) {
+	input := `
+func f(a: int, s): char {
+  var b = [1, -(a + 1) * 2];
+  b[0] = a - (b[1] - 2);
+  if (a < 2 && !(a == 0)) return s[0]; else { putc('\n'); }
+  while (true) break;
+  assert(a != 1, "a is 1");
+}
+`
+	expects := `func f(a: int, s): char {
+  var b = [1, -(a + 1) * 2];
+  b[0] = a - (b[1] - 2);
+  if ((a < 2) && !(a == 0)) {
+    return s[0];
+  } else {
+    putc('\n');
+  }
+  while (true) {
+    break;
+  }
+  assert(a != 1, "a is 1");
+}
+`
+
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	statements := parser.ParseProgram()
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred.")
+	}
+
+	if printed := printStatements(statements); printed != expects {
+		t.Fatalf("printed program wrong. expected=%q, got=%q", expects, printed)
+	}
+}
+
+func TestPrintAsm(t *testing.T) {
+	input := `
+func f(a) {
+  asm(out: 1) { push -1; }
+  asm(in: 1) { label l; jz l; }
+  return asm(out: 1) { copy 0; };
+}
+`
+	expects := `func f(a) {
+  asm(out: 1) {
+    push -1;
+  }
+  asm(in: 1) {
+    label l;
+    jz l;
+  }
+  return asm(out: 1) { copy 0; };
+}
+`
+
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	statements := parser.ParseProgram()
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	if printed := printStatements(statements); printed != expects {
+		t.Fatalf("printed program wrong. expected=%q, got=%q", expects, printed)
+	}
+}
@@ -12,19 +12,28 @@ type Resolver struct {
 	statements        []ast.Statement
 	declaredFunctions map[string]declaredFunction
 	calledFunctions   map[string]calledFunction
+	asmCalls          []asmCall
 	Errors            []string
 }
 
 type declaredFunction struct {
-	name  token.Token
-	arity int
+	name     token.Token
+	arity    int
+	exported bool
 }
 
 type calledFunction struct {
-	name  token.Token
+	call  ast.Call
 	arity int
 }
 
+// asmCall is a function called by the call instruction of an asm block,
+// which takes its arguments from the stack without checking their number.
+type asmCall struct {
+	callee token.Token
+	module string
+}
+
 func NewResolver(filename string, statements []ast.Statement) *Resolver {
 	return &Resolver{
 		filename:          filename,
@@ -45,40 +54,62 @@ func (r *Resolver) Resolve() {
 	}
 
 	for name, cf := range r.calledFunctions {
-		if bf, ok := buildinFunctions[name]; ok {
+		if bf, ok := lookupBuildinFunction(cf.call); ok {
 			if cf.arity != bf.arity {
 				r.resolveError(
-					cf.name,
+					cf.call.Callee,
 					fmt.Sprintf("Expected %d arguments, but got %d.", bf.arity, cf.arity),
 				)
 			}
-			return
+			continue
 		}
 
-		if df, ok := r.declaredFunctions[name]; ok {
-			if cf.arity != df.arity {
-				r.resolveError(
-					cf.name,
-					fmt.Sprintf("Expected %d arguments, but got %d.", df.arity, cf.arity),
-				)
-			}
-		} else {
-			r.resolveError(cf.name, "function is not declared.")
+		df, ok := r.declaredFunctions[name]
+		if !ok {
+			r.resolveError(cf.call.Callee, "function is not declared.")
+			continue
+		}
+
+		if cf.call.IsQualified() && !df.exported {
+			r.resolveError(cf.call.Callee, "function is not exported.")
+		}
+
+		if cf.arity != df.arity {
+			r.resolveError(
+				cf.call.Callee,
+				fmt.Sprintf("Expected %d arguments, but got %d.", df.arity, cf.arity),
+			)
+		}
+	}
+
+	for _, call := range r.asmCalls {
+		if _, ok := r.declaredFunctions[mangle(call.module, call.callee.Literal)]; !ok {
+			r.resolveError(call.callee, "function is not declared.")
 		}
 	}
 }
 
-func (r *Resolver) VisitVar(s ast.Var) { s.Expression.Visit(r) }
+func (r *Resolver) VisitVar(s ast.Var) {
+	r.resolveType(s.Type, false)
+	s.Expression.Visit(r)
+}
 func (r *Resolver) VisitFunction(s ast.Function) {
-	_, ok := r.declaredFunctions[s.Name.Literal]
+	name := mangle(s.Module, s.Name.Literal)
+	_, ok := r.declaredFunctions[name]
 	if ok {
 		r.resolveError(s.Name, "function is already declared.")
 	}
 
-	r.declaredFunctions[s.Name.Literal] = declaredFunction{
-		name:  s.Name,
-		arity: len(s.Params),
+	r.declaredFunctions[name] = declaredFunction{
+		name:     s.Name,
+		arity:    len(s.Params),
+		exported: s.Exported,
+	}
+
+	for _, typ := range s.ParamTypes {
+		r.resolveType(typ, false)
 	}
+	r.resolveType(s.ReturnType, true)
 
 	for _, stmt := range s.Body {
 		stmt.Visit(r)
@@ -107,6 +138,8 @@ func (r *Resolver) VisitBlock(s ast.Block) {
 	}
 }
 func (r *Resolver) VisitExpression(s ast.ExpressionStatement) { s.Expression.Visit(r) }
+func (r *Resolver) VisitAssert(s ast.Assert)                  { s.Condition.Visit(r) }
+func (r *Resolver) VisitAsmStatement(s ast.AsmStatement)      { r.VisitAsm(s.Asm) }
 
 func (r *Resolver) VisitAssign(e ast.Assign)           { e.Expression.Visit(r) }
 func (r *Resolver) VisitBinaryExpression(e ast.Binary) { e.Left.Visit(r); e.Right.Visit(r) }
@@ -116,8 +149,8 @@ func (r *Resolver) VisitCall(e ast.Call) {
 		arg.Visit(r)
 	}
 
-	r.calledFunctions[e.Callee.Literal] = calledFunction{
-		name:  e.Callee,
+	r.calledFunctions[mangle(e.Module, e.Callee.Literal)] = calledFunction{
+		call:  e,
 		arity: len(e.Arguments),
 	}
 }
@@ -138,6 +171,70 @@ func (r *Resolver) VisitIndex(e ast.Index) {
 	e.Index.Visit(r)
 }
 
+// VisitAsm checks the mnemonics and the operands of an asm block. Labels are
+// local to the block.
+func (r *Resolver) VisitAsm(e ast.Asm) {
+	marked := map[string]bool{}
+	for _, instruction := range e.Instructions {
+		op, ok := LookupMnemonic(instruction.Mnemonic.Literal)
+		if !ok {
+			r.resolveError(instruction.Mnemonic, "unknown asm instruction.")
+			continue
+		}
+
+		operand := instruction.Operand
+		switch {
+		case !op.HasArg() && !op.HasLabel():
+			if operand.Type != "" {
+				r.resolveError(operand, "unexpected operand.")
+			}
+		case operand.Type == "":
+			r.resolveError(instruction.Mnemonic, "expect operand.")
+		case op.HasArg():
+			if operand.Type != token.INT {
+				r.resolveError(operand, "expect number.")
+			}
+		case operand.Type != token.IDENT:
+			r.resolveError(operand, "expect name.")
+		case op == CALLSUB:
+			r.asmCalls = append(r.asmCalls, asmCall{callee: operand, module: e.Module})
+		case op == LABEL:
+			if marked[operand.Literal] {
+				r.resolveError(operand, "label is already marked.")
+			}
+			marked[operand.Literal] = true
+		}
+	}
+
+	for _, instruction := range e.Instructions {
+		op, _ := LookupMnemonic(instruction.Mnemonic.Literal)
+		if isJump(op) && op != CALLSUB && instruction.Operand.Type == token.IDENT && !marked[instruction.Operand.Literal] {
+			r.resolveError(instruction.Operand, "label is not marked in this asm block.")
+		}
+	}
+}
+
+func (r *Resolver) resolveType(t *ast.TypeAnnotation, allowVoid bool) {
+	if t == nil {
+		return
+	}
+
+	if t.Elem != nil {
+		r.resolveType(t.Elem, false)
+		return
+	}
+
+	typ, ok := typeNames[t.Token.Literal]
+	if !ok {
+		r.resolveError(t.Token, "unknown type.")
+		return
+	}
+
+	if typ == voidType && !allowVoid {
+		r.resolveError(t.Token, "void can only be used as return type.")
+	}
+}
+
 func (r *Resolver) HadErrors() bool {
 	return len(r.Errors) != 0
 }
@@ -41,3 +41,84 @@ func TestResolveFunctionArity(t *testing.T) {
 		t.Fatalf("Does not includes function arity error.")
 	}
 }
+
+func TestResolveTypeAnnotation(t *testing.T) {
+	input := "var a: foo = 1; func f(b: [void]): void { }"
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	stmts := parser.ParseProgram()
+	resolver := NewResolver("script", stmts)
+	resolver.Resolve()
+
+	if len(resolver.Errors) != 2 {
+		t.Fatalf("Resolve errors count does not match. %v", resolver.Errors)
+	}
+
+	if !strings.Contains(resolver.Errors[0], "at 'foo': unknown type.") {
+		t.Fatalf("Does not includes unknown type error.")
+	}
+
+	if !strings.Contains(resolver.Errors[1], "void can only be used as return type.") {
+		t.Fatalf("Does not includes void type error.")
+	}
+}
+
+func TestResolveExportedFunction(t *testing.T) {
+	input := `import "../fixtures/module.sflt" as m; m.f(1); m.g(1);`
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	stmts := parser.ParseProgram()
+	resolver := NewResolver("script", stmts)
+	resolver.Resolve()
+
+	if len(resolver.Errors) != 1 {
+		t.Fatalf("Resolve errors count does not match. %v", resolver.Errors)
+	}
+
+	if !strings.Contains(resolver.Errors[0], "at 'g': function is not exported.") {
+		t.Fatalf("Does not includes not exported error.")
+	}
+}
+
+func TestResolveAsm(t *testing.T) {
+	input := "asm { pop; push; dup 1; push x; jump b; label a; label a; }"
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	stmts := parser.ParseProgram()
+	resolver := NewResolver("script", stmts)
+	resolver.Resolve()
+
+	expects := []string{
+		"at 'pop': unknown asm instruction.",
+		"at 'push': expect operand.",
+		"at '1': unexpected operand.",
+		"at 'x': expect number.",
+		"at 'a': label is already marked.",
+		"at 'b': label is not marked in this asm block.",
+	}
+	if len(resolver.Errors) != len(expects) {
+		t.Fatalf("Resolve errors count does not match. %v", resolver.Errors)
+	}
+	for i, expect := range expects {
+		if !strings.Contains(resolver.Errors[i], expect) {
+			t.Fatalf("tests[%d] - Does not includes %q. got=%q", i, expect, resolver.Errors[i])
+		}
+	}
+}
+
+func TestResolveAsmCall(t *testing.T) {
+	input := "func f() { asm { call g; } return 0; }"
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	stmts := parser.ParseProgram()
+	resolver := NewResolver("script", stmts)
+	resolver.Resolve()
+
+	if len(resolver.Errors) != 1 {
+		t.Fatalf("Resolve errors count does not match. %v", resolver.Errors)
+	}
+
+	if !strings.Contains(resolver.Errors[0], "at 'g': function is not declared.") {
+		t.Fatalf("Does not includes not declared error.")
+	}
+}
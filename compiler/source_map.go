@@ -0,0 +1,94 @@
+package compiler
+
+import "sort"
+
+// SourceMap maps the instructions of a program, and the characters of its
+// formatted output, to the source they are compiled from. It is written as
+// JSON next to the output.
+type SourceMap struct {
+	Version int `json:"version"`
+	// File is the output the map belongs to.
+	File string `json:"file"`
+	// Sources are the files of the source, in order of first appearance.
+	// The build-in libraries are named after their include names.
+	Sources  []string  `json:"sources"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping is the source position of an instruction. Offset is the index of
+// the instruction, and Start and End are the range of its characters in the
+// output, which may contain the line breaks of the format. Source is the
+// index in Sources.
+type Mapping struct {
+	Offset int `json:"offset"`
+	Start  int `json:"start"`
+	End    int `json:"end"`
+	Source int `json:"source"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+const sourceMapVersion = 1
+
+// NewSourceMap maps instructions to output, which is the formatted encoding
+// of them. Characters other than F, L and T in output are skipped. The
+// runtime routines have no source position and no mapping.
+func NewSourceMap(file string, instructions []Instruction, output string) *SourceMap {
+	sourceMap := &SourceMap{
+		Version:  sourceMapVersion,
+		File:     file,
+		Sources:  []string{},
+		Mappings: []Mapping{},
+	}
+	sources := map[string]int{}
+
+	position := 0
+	for offset, instruction := range instructions {
+		start, end := -1, position
+		for n := len(instruction.Encode()); n > 0 && position < len(output); position++ {
+			switch output[position] {
+			case 'F', 'L', 'T':
+				if start < 0 {
+					start = position
+				}
+				end = position + 1
+				n--
+			}
+		}
+
+		pos := instruction.SourcePos
+		if pos.Line == 0 {
+			continue
+		}
+
+		source, ok := sources[pos.Filename]
+		if !ok {
+			source = len(sourceMap.Sources)
+			sources[pos.Filename] = source
+			sourceMap.Sources = append(sourceMap.Sources, pos.Filename)
+		}
+
+		sourceMap.Mappings = append(sourceMap.Mappings, Mapping{
+			Offset: offset,
+			Start:  start,
+			End:    end,
+			Source: source,
+			Line:   pos.Line,
+			Column: pos.Column,
+		})
+	}
+
+	return sourceMap
+}
+
+// Lookup finds the source position of the instruction which the character at
+// position of the output belongs to.
+func (s *SourceMap) Lookup(position int) (SourcePos, bool) {
+	i := sort.Search(len(s.Mappings), func(i int) bool { return s.Mappings[i].End > position })
+	if i == len(s.Mappings) || s.Mappings[i].Start > position {
+		return SourcePos{}, false
+	}
+
+	mapping := s.Mappings[i]
+	return SourcePos{Filename: s.Sources[mapping.Source], Line: mapping.Line, Column: mapping.Column}, true
+}
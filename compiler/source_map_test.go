@@ -0,0 +1,63 @@
+package compiler
+
+import "testing"
+
+func TestNewSourceMap(t *testing.T) {
+	instructions := []Instruction{
+		{Op: PUSH, Arg: VM_ALLOC_REC},
+		{Op: PUSH, Arg: 5, SourcePos: SourcePos{Filename: "script", Line: 1, Column: 6}},
+		{Op: PUTN, SourcePos: SourcePos{Filename: "script", Line: 1, Column: 4}},
+		{Op: CALLSUB, Label: 1, SourcePos: SourcePos{Filename: "strings", Line: 3, Column: 2}},
+		{Op: END},
+	}
+	// push 65536, push 5, putn, call 1 and end with a line break in call 1.
+	output := "FFFLFFFFFFFFFFFFFFFFT  FFFLFLT\nLTFLTFL\nLT\nTTT"
+
+	sourceMap := NewSourceMap("script.fflt", instructions, output)
+	if len(sourceMap.Sources) != 2 || sourceMap.Sources[0] != "script" || sourceMap.Sources[1] != "strings" {
+		t.Fatalf("sources wrong. got=%v", sourceMap.Sources)
+	}
+
+	expects := []Mapping{
+		{Offset: 1, Start: 23, End: 30, Source: 0, Line: 1, Column: 6},
+		{Offset: 2, Start: 31, End: 35, Source: 0, Line: 1, Column: 4},
+		{Offset: 3, Start: 35, End: 41, Source: 1, Line: 3, Column: 2},
+	}
+	if len(sourceMap.Mappings) != len(expects) {
+		t.Fatalf("mappings count wrong. expected=%d, got=%d", len(expects), len(sourceMap.Mappings))
+	}
+	for i, expect := range expects {
+		if sourceMap.Mappings[i] != expect {
+			t.Fatalf("tests[%d] - mapping wrong. expected=%+v, got=%+v", i, expect, sourceMap.Mappings[i])
+		}
+	}
+}
+
+func TestSourceMapLookup(t *testing.T) {
+	instructions := []Instruction{
+		{Op: PUSH, Arg: 1},
+		{Op: PUSH, Arg: 2, SourcePos: SourcePos{Filename: "script", Line: 2, Column: 3}},
+		{Op: END},
+	}
+	sourceMap := NewSourceMap("script.fflt", instructions, "FFFLT\nFFFLFT\nTTT")
+
+	tests := []struct {
+		position int
+		expect   SourcePos
+		ok       bool
+	}{
+		{0, SourcePos{}, false},
+		{5, SourcePos{}, false},
+		{6, SourcePos{Filename: "script", Line: 2, Column: 3}, true},
+		{11, SourcePos{Filename: "script", Line: 2, Column: 3}, true},
+		{12, SourcePos{}, false},
+		{14, SourcePos{}, false},
+	}
+
+	for i, tt := range tests {
+		pos, ok := sourceMap.Lookup(tt.position)
+		if ok != tt.ok || pos != tt.expect {
+			t.Fatalf("tests[%d] - lookup wrong. expected=%+v %t, got=%+v %t", i, tt.expect, tt.ok, pos, ok)
+		}
+	}
+}
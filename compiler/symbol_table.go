@@ -0,0 +1,45 @@
+package compiler
+
+import "github.com/simomu-github/sfflt_lang/token"
+
+// symbolTable assigns dense sequential addresses to global variables and
+// labels to functions in order of first reference, so that different names
+// never share an address or a label.
+type symbolTable struct {
+	globals        map[string]int64
+	functionLabels map[string]int
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{
+		globals:        map[string]int64{},
+		functionLabels: map[string]int{},
+	}
+}
+
+func (c *Compiler) globalAddress(name token.Token, module string) int64 {
+	mangled := mangle(module, name.Literal)
+	if addr, ok := c.symbols.globals[mangled]; ok {
+		return addr
+	}
+
+	index := int64(len(c.symbols.globals))
+	if GLOBAL_VAR_ADDR+index >= LOCAL_VAR_ADDR {
+		c.compileError(name, "Too many global variables.")
+	}
+
+	c.symbols.globals[mangled] = GLOBAL_VAR_ADDR + index
+	return GLOBAL_VAR_ADDR + index
+}
+
+// functionLabel shares the label counter with jump labels.
+func (c *Compiler) functionLabel(name string, module string) int {
+	mangled := mangle(module, name)
+	if label, ok := c.symbols.functionLabels[mangled]; ok {
+		return label
+	}
+
+	label := c.newLabel()
+	c.symbols.functionLabels[mangled] = label
+	return label
+}
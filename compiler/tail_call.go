@@ -0,0 +1,55 @@
+package compiler
+
+import "github.com/simomu-github/sfflt_lang/ast"
+
+// VM_TAIL_CALL_ARGS is the scratch area used to move the arguments of a tail
+// call over the parameters of the returning function.
+const VM_TAIL_CALL_ARGS = VM_ADDR + 1
+
+// tailCall compiles return f(...) into a jump to f which reuses the frame of
+// the current function. The arguments replace the parameters on the stack,
+// so recursion in tail position runs in constant stack space.
+func (c *Compiler) tailCall(e ast.Call) bool {
+	if _, ok := lookupBuildinFunction(e); ok {
+		return false
+	}
+
+	for _, arg := range e.Arguments {
+		arg.Visit(c)
+		c.hold(1)
+	}
+	c.release(len(e.Arguments))
+
+	c.replaceParams(len(e.Arguments))
+	c.replaceCallSite(e)
+	c.addInstructionWithLabel(JUMP, c.functionLabel(e.Callee.Literal, e.Module))
+	return true
+}
+
+// replaceParams drops the parameters of the current function below the count
+// arguments on the top of the stack. The arguments except the first are moved
+// through the scratch area, because SLIDE keeps only the top value.
+func (c *Compiler) replaceParams(count int) {
+	params := c.compilingFunction.ParamCount
+	if count == 0 {
+		for i := 0; i < params; i++ {
+			c.addInstruction(DISCARD)
+		}
+		return
+	}
+
+	for i := count - 1; i > 0; i-- {
+		c.addInstructionWithArg(PUSH, VM_TAIL_CALL_ARGS+int64(i))
+		c.addInstruction(SWAP)
+		c.addInstruction(STORE)
+	}
+
+	if params != 0 {
+		c.addInstructionWithArg(SLIDE, int64(params))
+	}
+
+	for i := 1; i < count; i++ {
+		c.addInstructionWithArg(PUSH, VM_TAIL_CALL_ARGS+int64(i))
+		c.addInstruction(RETRIEVE)
+	}
+}
@@ -0,0 +1,42 @@
+package compiler
+
+import "testing"
+
+func TestCompileTailCall(t *testing.T) {
+	input := "func f(a, b) { return f(b, a); }"
+	instructions := compileWithoutGC(input, t)
+	expects := []string{
+		"TTT",     // end
+		"TFFFT",   // mark label f
+		"FLFFFT",  // copy 0 (b)
+		"FLFFLFT", // copy 2 (a)
+		"FFFLFT",  // push tail call argument address 2
+		"FTL",     // swap
+		"LLF",     // store
+		"FLTFLFT", // slide 2
+		"FFFLFT",  // push tail call argument address 2
+		"LLL",     // retrieve
+		"TFTFT",   // jump f
+		"FFFFT",   // push 0
+		"FLTFLFT", // slide 2
+		"TLT",     // end sub
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileTailCallWithoutParams(t *testing.T) {
+	input := "func f(a) { return g(); } func g() { return 0; }"
+	instructions := compileWithoutGC(input, t)
+	expects := []string{
+		"TTT",    // end
+		"TFFFT",  // mark label f
+		"FTT",    // discard a
+		"TFTLT",  // jump g
+		"FFFFT",  // push 0
+		"FLTFLT", // slide 1
+		"TLT",    // end sub
+	}
+
+	assertInstructions(instructions, expects, t)
+}
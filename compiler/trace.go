@@ -0,0 +1,136 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+)
+
+// VM_CALL_STACK holds the depth of the shadow call stack in checked mode, and
+// the id of the call site of each active call is stored above it. It is
+// placed above the heap mark table, so the stack grows as deep as the calls
+// without running into other memory.
+const VM_CALL_STACK = int64(0b11) << 36
+
+// callSite is a call of a user function recorded for stack traces.
+type callSite struct {
+	callee   string
+	filename string
+	line     int
+}
+
+// pushCallSite records the call e on the shadow call stack in checked mode.
+func (c *Compiler) pushCallSite(e ast.Call) {
+	if !c.Checked {
+		return
+	}
+
+	c.addInstructionWithArg(PUSH, VM_CALL_STACK)
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE)
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstruction(ADD)
+	c.addInstruction(STORE)
+
+	c.storeCallSite(e)
+}
+
+// replaceCallSite records the tail call e in place of the returning call.
+func (c *Compiler) replaceCallSite(e ast.Call) {
+	if !c.Checked {
+		return
+	}
+
+	c.storeCallSite(e)
+}
+
+// storeCallSite stores the id of e on the top of the shadow call stack.
+func (c *Compiler) storeCallSite(e ast.Call) {
+	callee := e.Callee.Literal
+	if e.IsQualified() {
+		callee = e.Namespace.Literal + "." + callee
+	}
+	id := len(c.callSites)
+	c.callSites = append(c.callSites, callSite{
+		callee:   callee,
+		filename: e.Callee.Filename,
+		line:     e.Callee.Line,
+	})
+
+	c.addInstructionWithArg(PUSH, VM_CALL_STACK)
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE)
+	c.addInstruction(ADD)
+	c.addInstructionWithArg(PUSH, int64(id))
+	c.addInstruction(STORE)
+}
+
+// popCallSite removes the returned call from the shadow call stack.
+func (c *Compiler) popCallSite() {
+	if !c.Checked {
+		return
+	}
+
+	c.addInstructionWithArg(PUSH, VM_CALL_STACK)
+	c.addInstruction(DUP)
+	c.addInstruction(RETRIEVE)
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstruction(SUB)
+	c.addInstruction(STORE)
+}
+
+// callStackTrace prints the active calls from the shadow call stack.
+func (c *Compiler) callStackTrace() {
+	if c.stackTraceLabel == noLabel {
+		c.stackTraceLabel = c.newLabel()
+	}
+	c.addInstructionWithLabel(CALLSUB, c.stackTraceLabel)
+}
+
+// stackTraceRoutine emits _stackTrace(), which prints the callee and the
+// position of every active call from the innermost one. The messages are
+// selected by the call site ids from the table built while compiling calls.
+func (c *Compiler) stackTraceRoutine() {
+	c.addInstructionWithLabel(LABEL, c.stackTraceLabel)
+
+	c.addInstructionWithArg(PUSH, VM_CALL_STACK)
+	c.addInstruction(RETRIEVE) // depth
+
+	loopLabel := c.markJumpLabel()
+	c.addInstruction(DUP)
+	endPos := c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	c.addInstruction(DUP)
+	c.addInstructionWithArg(PUSH, VM_CALL_STACK)
+	c.addInstruction(ADD)
+	c.addInstruction(RETRIEVE) // call site id
+
+	sitePositions := make([]int, len(c.callSites))
+	for i := range c.callSites {
+		c.addInstruction(DUP)
+		c.addInstructionWithArg(PUSH, int64(i))
+		c.addInstruction(SUB)
+		sitePositions[i] = c.reserveJumpLabel(JUMP_WHEN_ZERO)
+	}
+	nextPositions := []int{c.reserveJumpLabel(JUMP)}
+
+	for i, site := range c.callSites {
+		siteLabel := c.markJumpLabel()
+		c.confirmJumpLabel(sitePositions[i], siteLabel)
+		c.putString(fmt.Sprintf("  %s called at %s:%d\n", site.callee, site.filename, site.line))
+		nextPositions = append(nextPositions, c.reserveJumpLabel(JUMP))
+	}
+
+	nextLabel := c.markJumpLabel()
+	for _, pos := range nextPositions {
+		c.confirmJumpLabel(pos, nextLabel)
+	}
+	c.addInstruction(DISCARD)
+	c.addInstructionWithArg(PUSH, 1)
+	c.addInstruction(SUB)
+	c.addInstructionWithLabel(JUMP, loopLabel)
+
+	endLabel := c.markJumpLabel()
+	c.confirmJumpLabel(endPos, endLabel)
+	c.addInstruction(DISCARD)
+	c.addInstruction(ENDSUB)
+}
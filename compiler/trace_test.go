@@ -0,0 +1,77 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileCallSite(t *testing.T) {
+	input := "func f() { 1; } f();"
+	instructions := compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Checked = true }, t)
+	expects := []string{
+		// push call site
+		"FFFLLFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFT", // push call stack address
+		"FTF",   // dup
+		"LLL",   // retrieve depth
+		"FFFLT", // push 1
+		"LFFF",  // add
+		"LLF",   // store depth
+		"FFFLLFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFT", // push call stack address
+		"FTF",   // dup
+		"LLL",   // retrieve depth
+		"LFFF",  // add
+		"FFFFT", // push call site 0
+		"LLF",   // store
+
+		"TFLFT", // call f
+
+		// pop call site
+		"FFFLLFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFT", // push call stack address
+		"FTF",   // dup
+		"LLL",   // retrieve depth
+		"FFFLT", // push 1
+		"LFFL",  // sub
+		"LLF",   // store depth
+	}
+
+	assertInstructions(instructions, expects, t)
+}
+
+func TestCompileStackTrace(t *testing.T) {
+	input := "func f(a) { return 1 / a; } f(0);"
+	instructions := strings.Join(compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Checked = true }, t), " ")
+
+	message := New(nil)
+	message.putString("  f called at script:1\n")
+	if !strings.Contains(instructions, strings.Join(Encode(message.instructions), " ")) {
+		t.Fatalf("Does not includes stack trace of f.")
+	}
+}
+
+func TestCompileAssertStackTrace(t *testing.T) {
+	input := "func f(a) { assert(a > 0); } f(0);"
+	instructions := strings.Join(compileWith(input, func(c *Compiler) { c.DisableGC = true; c.Checked = true }, t), " ")
+
+	message := New(nil)
+	message.putString("  f called at script:1\n")
+	if !strings.Contains(instructions, strings.Join(Encode(message.instructions), " ")) {
+		t.Fatalf("Does not includes stack trace of f.")
+	}
+}
+
+func TestCallStackDoesNotOverwriteGlobals(t *testing.T) {
+	input := `
+var g = 42;
+func down(n) {
+  if (n == 0) { return 0; }
+  var r = down(n - 1);
+  return r + 1;
+}
+putn(down(70000)); putc(' '); putn(g);
+`
+	instructions := compileWith(input, func(c *Compiler) { c.Checked = true }, t)
+	output := execute(decodeInstructions(instructions), t)
+	if output != "70000 42" {
+		t.Fatalf("output wrong. expected=%q, got=%q", "70000 42", output)
+	}
+}
@@ -0,0 +1,372 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/simomu-github/sfflt_lang/ast"
+	"github.com/simomu-github/sfflt_lang/token"
+)
+
+type TypeChecker struct {
+	filename        string
+	statements      []ast.Statement
+	functions       map[string]*functionType
+	globals         map[string]*Type
+	scopes          []map[string]*Type
+	currentFunction *functionType
+	lastType        *Type
+	Errors          []string
+}
+
+type functionType struct {
+	params     []*Type
+	returnType *Type
+	// declared holds the parameter names which have type annotations.
+	declared map[int]token.Token
+}
+
+func NewTypeChecker(filename string, statements []ast.Statement) *TypeChecker {
+	return &TypeChecker{
+		filename:   filename,
+		statements: statements,
+		functions:  map[string]*functionType{},
+		globals:    map[string]*Type{},
+		scopes:     []map[string]*Type{},
+		Errors:     []string{},
+	}
+}
+
+func (c *TypeChecker) Check() {
+	for _, stmt := range c.statements {
+		if f, ok := stmt.(ast.Function); ok {
+			params := []*Type{}
+			declared := map[int]token.Token{}
+			for i, param := range f.Params {
+				var annotation *ast.TypeAnnotation
+				if i < len(f.ParamTypes) {
+					annotation = f.ParamTypes[i]
+				}
+				if annotation != nil {
+					declared[i] = param
+				}
+				params = append(params, annotationType(annotation))
+			}
+
+			c.functions[mangle(f.Module, f.Name.Literal)] = &functionType{
+				params:     params,
+				returnType: annotationType(f.ReturnType),
+				declared:   declared,
+			}
+		}
+	}
+
+	for _, stmt := range c.statements {
+		stmt.Visit(c)
+	}
+}
+
+func (c *TypeChecker) VisitVar(s ast.Var) {
+	typ := c.typeOf(s.Expression)
+	if s.Type != nil {
+		declared := annotationType(s.Type)
+		c.expect(expressionToken(s.Expression), declared, typ)
+		typ = declared
+	}
+
+	if s.IsLocal {
+		c.scopes[len(c.scopes)-1][s.Identifier.Literal] = typ
+		return
+	}
+
+	c.expect(s.Identifier, c.lookup(s.Identifier.Literal, s.Module), typ)
+}
+
+func (c *TypeChecker) VisitFunction(s ast.Function) {
+	c.currentFunction = c.functions[mangle(s.Module, s.Name.Literal)]
+
+	c.beginScope()
+	for i, param := range s.Params {
+		c.scopes[len(c.scopes)-1][param.Literal] = c.currentFunction.params[i]
+	}
+
+	c.beginScope()
+	for _, stmt := range s.Body {
+		stmt.Visit(c)
+	}
+	c.endScope()
+	c.endScope()
+
+	c.currentFunction = nil
+}
+
+func (c *TypeChecker) VisitReturn(s ast.Return) {
+	if s.Value == nil {
+		c.expect(s.Token, c.currentFunction.returnType, voidType)
+		return
+	}
+
+	c.expect(expressionToken(s.Value), c.currentFunction.returnType, c.typeOf(s.Value))
+}
+
+func (c *TypeChecker) VisitBreak(s ast.Break) {}
+
+func (c *TypeChecker) VisitIf(s ast.If) {
+	c.condition(s.Condition)
+	s.Then.Visit(c)
+	if s.Else != nil {
+		s.Else.Visit(c)
+	}
+}
+
+func (c *TypeChecker) VisitWhile(s ast.While) {
+	c.condition(s.Condition)
+	s.Body.Visit(c)
+}
+
+func (c *TypeChecker) VisitBlock(s ast.Block) {
+	c.beginScope()
+	for _, stmt := range s.Statements {
+		stmt.Visit(c)
+	}
+	c.endScope()
+}
+
+func (c *TypeChecker) VisitExpression(s ast.ExpressionStatement) { c.typeOf(s.Expression) }
+func (c *TypeChecker) VisitAssert(s ast.Assert)                  { c.condition(s.Condition) }
+func (c *TypeChecker) VisitAsmStatement(s ast.AsmStatement)      {}
+
+func (c *TypeChecker) VisitAssign(e ast.Assign) {
+	var target *Type
+	switch t := e.Target.(type) {
+	case ast.Variable:
+		target = c.lookup(t.Identifier.Literal, t.Module)
+	case ast.Index:
+		target = c.typeOf(t)
+	}
+
+	c.expect(expressionToken(e.Expression), target, c.typeOf(e.Expression))
+	c.lastType = target
+}
+
+func (c *TypeChecker) VisitBinaryExpression(e ast.Binary) {
+	left := c.typeOf(e.Left)
+	right := c.typeOf(e.Right)
+
+	switch e.Operator.Type {
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.MOD:
+		c.numeric(e.Operator, left)
+		c.numeric(e.Operator, right)
+		c.lastType = intType
+	case token.LT, token.LTEQ, token.GT, token.GTEQ:
+		c.numeric(e.Operator, left)
+		c.numeric(e.Operator, right)
+		c.lastType = boolType
+	case token.EQ, token.NOT_EQ:
+		c.expect(e.Operator, left, right)
+		c.lastType = boolType
+	case token.AND, token.OR:
+		c.expect(e.Operator, boolType, left)
+		c.expect(e.Operator, boolType, right)
+		c.lastType = boolType
+	}
+}
+
+func (c *TypeChecker) VisitUnaryExpression(e ast.Unary) {
+	right := c.typeOf(e.Right)
+
+	switch e.Operator.Type {
+	case token.MINUS:
+		c.numeric(e.Operator, right)
+		c.lastType = intType
+	case token.BANG:
+		c.expect(e.Operator, boolType, right)
+		c.lastType = boolType
+	default:
+		c.lastType = right
+	}
+}
+
+func (c *TypeChecker) VisitCall(e ast.Call) {
+	arguments := []*Type{}
+	for _, arg := range e.Arguments {
+		arguments = append(arguments, c.typeOf(arg))
+	}
+
+	var params []*Type
+	var returnType *Type
+	declared := map[int]token.Token{}
+	if b, ok := lookupBuildinFunction(e); ok {
+		if b.signature == nil {
+			c.lastType = newTypeVariable()
+			return
+		}
+		params, returnType = b.signature()
+	} else if f, ok := c.functions[mangle(e.Module, e.Callee.Literal)]; ok {
+		params, returnType, declared = f.params, f.returnType, f.declared
+	} else {
+		// Undeclared functions are reported by the resolver.
+		c.lastType = newTypeVariable()
+		return
+	}
+
+	for i, param := range params {
+		if i >= len(arguments) {
+			break
+		}
+
+		if unify(param, arguments[i]) {
+			continue
+		}
+
+		if name, ok := declared[i]; ok {
+			c.typeError(
+				expressionToken(e.Arguments[i]),
+				fmt.Sprintf("Argument '%s' of '%s' is declared as %s, but got %s.", name.Literal, e.Callee.Literal, param, arguments[i]),
+			)
+		} else {
+			c.typeError(
+				e.Callee,
+				fmt.Sprintf("Argument %d of '%s' expects %s, but got %s.", i+1, e.Callee.Literal, param, arguments[i]),
+			)
+		}
+	}
+
+	c.lastType = returnType
+}
+
+func (c *TypeChecker) VisitIntegerLiteral(e ast.IntegerLiteral) { c.lastType = intType }
+func (c *TypeChecker) VisitCharLiteral(e ast.CharLiteral)       { c.lastType = charType }
+func (c *TypeChecker) VisitStringLiteral(e ast.StringLiteral)   { c.lastType = stringType }
+func (c *TypeChecker) VisitBooleanLiteral(e ast.BooleanLiteral) { c.lastType = boolType }
+func (c *TypeChecker) VisitVariable(e ast.Variable) {
+	c.lastType = c.lookup(e.Identifier.Literal, e.Module)
+}
+
+func (c *TypeChecker) VisitArrayLiteral(e ast.ArrayLiteral) {
+	elem := newTypeVariable()
+	for _, element := range e.Elements {
+		c.expect(expressionToken(element), elem, c.typeOf(element))
+	}
+
+	c.lastType = newArrayType(elem)
+}
+
+func (c *TypeChecker) VisitIndex(e ast.Index) {
+	elem := newTypeVariable()
+	c.expect(e.Token, newArrayType(elem), c.typeOf(e.Receiver))
+	c.numeric(e.Token, c.typeOf(e.Index))
+
+	c.lastType = elem
+}
+
+// VisitAsm gives the value of an asm block a fresh type, which is inferred
+// from where the value is used.
+func (c *TypeChecker) VisitAsm(e ast.Asm) {
+	c.lastType = newTypeVariable()
+}
+
+func (c *TypeChecker) HadErrors() bool {
+	return len(c.Errors) != 0
+}
+
+func (c *TypeChecker) typeOf(e ast.Expression) *Type {
+	e.Visit(c)
+	return c.lastType
+}
+
+func (c *TypeChecker) condition(e ast.Expression) {
+	typ := c.typeOf(e)
+	if !unify(boolType, typ) {
+		c.typeError(expressionToken(e), fmt.Sprintf("Condition must be bool, but got %s.", typ))
+	}
+}
+
+func (c *TypeChecker) numeric(tok token.Token, typ *Type) {
+	if prune(typ).Kind == VARIABLE_TYPE {
+		unify(typ, intType)
+		return
+	}
+
+	if !typ.isNumeric() {
+		c.typeError(tok, fmt.Sprintf("Operand of '%s' must be int or char, but got %s.", tok.Literal, typ))
+	}
+}
+
+func (c *TypeChecker) expect(tok token.Token, expected *Type, actual *Type) {
+	if !unify(expected, actual) {
+		c.typeError(tok, fmt.Sprintf("Type mismatch: expected %s, but got %s.", expected, actual))
+	}
+}
+
+func (c *TypeChecker) lookup(name string, module string) *Type {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if typ, ok := c.scopes[i][name]; ok {
+			return typ
+		}
+	}
+
+	global := mangle(module, name)
+	typ, ok := c.globals[global]
+	if !ok {
+		typ = newTypeVariable()
+		c.globals[global] = typ
+	}
+
+	return typ
+}
+
+func (c *TypeChecker) beginScope() {
+	c.scopes = append(c.scopes, map[string]*Type{})
+}
+
+func (c *TypeChecker) endScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *TypeChecker) typeError(tok token.Token, message string) {
+	filename := tok.Filename
+	if filename == "" {
+		filename = c.filename
+	}
+
+	c.Errors = append(
+		c.Errors,
+		fmt.Sprintf("%s:%d Error at '%s': %s\n", filename, tok.Line, tok.Literal, message),
+	)
+}
+
+func expressionToken(e ast.Expression) token.Token {
+	switch e := e.(type) {
+	case ast.Assign:
+		if v, ok := e.Target.(ast.Variable); ok {
+			return v.Identifier
+		}
+		if i, ok := e.Target.(ast.Index); ok {
+			return i.Token
+		}
+	case ast.Binary:
+		return e.Operator
+	case ast.Unary:
+		return e.Operator
+	case ast.Call:
+		return e.Callee
+	case ast.IntegerLiteral:
+		return e.Token
+	case ast.CharLiteral:
+		return e.Token
+	case ast.StringLiteral:
+		return e.Token
+	case ast.BooleanLiteral:
+		return e.Token
+	case ast.Variable:
+		return e.Identifier
+	case ast.ArrayLiteral:
+		return e.Token
+	case ast.Index:
+		return e.Token
+	case ast.Asm:
+		return e.Token
+	}
+
+	return token.Token{}
+}
@@ -0,0 +1,117 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/simomu-github/sfflt_lang/lexer"
+	"github.com/simomu-github/sfflt_lang/parser"
+)
+
+func TestTypeCheckInference(t *testing.T) {
+	input := `
+func fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+func first(ary) { return ary[0]; }
+var a = [1, 2];
+var s = "abc";
+putn(fib(first(a)));
+putc(s[0] + 1);
+append(s, 'd');
+`
+	checker := typeCheck(input)
+
+	if checker.HadErrors() {
+		t.Fatalf("Type error occurred. %v", checker.Errors)
+	}
+}
+
+func TestTypeCheckBuildinFunctionArguments(t *testing.T) {
+	input := `len(5); putn("abc");`
+	checker := typeCheck(input)
+
+	if len(checker.Errors) != 2 {
+		t.Fatalf("Type errors count does not match. %v", checker.Errors)
+	}
+
+	if !strings.Contains(checker.Errors[0], "Argument 1 of 'len' expects [any], but got int.") {
+		t.Fatalf("Does not includes len argument error. %s", checker.Errors[0])
+	}
+
+	if !strings.Contains(checker.Errors[1], "Argument 1 of 'putn' expects int, but got string.") {
+		t.Fatalf("Does not includes putn argument error. %s", checker.Errors[1])
+	}
+}
+
+func TestTypeCheckFunctionArguments(t *testing.T) {
+	input := `func f(a) { return a + 1; } f(1); f([1]);`
+	checker := typeCheck(input)
+
+	if !checker.HadErrors() {
+		t.Fatalf("No error occurs.")
+	}
+
+	if !strings.Contains(checker.Errors[0], "Argument 1 of 'f' expects int, but got [int].") {
+		t.Fatalf("Does not includes argument error. %s", checker.Errors[0])
+	}
+}
+
+func TestTypeCheckVariable(t *testing.T) {
+	input := `var a = 'a'; a = 1; { var b = true; b = "b"; }`
+	checker := typeCheck(input)
+
+	if len(checker.Errors) != 1 {
+		t.Fatalf("Type errors count does not match. %v", checker.Errors)
+	}
+
+	if !strings.Contains(checker.Errors[0], "Type mismatch: expected bool, but got string.") {
+		t.Fatalf("Does not includes type mismatch error. %s", checker.Errors[0])
+	}
+}
+
+func TestTypeCheckReturn(t *testing.T) {
+	input := `func f(a) { if (a) return; return 1; } if (1) {}`
+	checker := typeCheck(input)
+
+	if len(checker.Errors) != 2 {
+		t.Fatalf("Type errors count does not match. %v", checker.Errors)
+	}
+
+	if !strings.Contains(checker.Errors[0], "Type mismatch: expected void, but got int.") {
+		t.Fatalf("Does not includes return error. %s", checker.Errors[0])
+	}
+
+	if !strings.Contains(checker.Errors[1], "Condition must be bool, but got int.") {
+		t.Fatalf("Does not includes condition error. %s", checker.Errors[1])
+	}
+}
+
+func TestTypeCheckTypeAnnotation(t *testing.T) {
+	input := `
+func find(ary: [int], x: int): int { return 0; }
+find([1], "x");
+var a: bool = 1;
+`
+	checker := typeCheck(input)
+
+	if len(checker.Errors) != 2 {
+		t.Fatalf("Type errors count does not match. %v", checker.Errors)
+	}
+
+	if !strings.Contains(checker.Errors[0], "Argument 'x' of 'find' is declared as int, but got string.") {
+		t.Fatalf("Does not includes declared argument error. %s", checker.Errors[0])
+	}
+
+	if !strings.Contains(checker.Errors[1], "Type mismatch: expected bool, but got int.") {
+		t.Fatalf("Does not includes variable type error. %s", checker.Errors[1])
+	}
+}
+
+func typeCheck(input string) *TypeChecker {
+	lexer := lexer.New("script", input)
+	parser := parser.New(lexer)
+	stmts := parser.ParseProgram()
+	checker := NewTypeChecker("script", stmts)
+	checker.Check()
+
+	return checker
+}
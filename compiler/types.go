@@ -0,0 +1,137 @@
+package compiler
+
+import "github.com/simomu-github/sfflt_lang/ast"
+
+const (
+	VARIABLE_TYPE = "VARIABLE"
+	INT_TYPE      = "int"
+	CHAR_TYPE     = "char"
+	BOOL_TYPE     = "bool"
+	STRING_TYPE   = "string"
+	ARRAY_TYPE    = "array"
+	VOID_TYPE     = "void"
+)
+
+type TypeKind string
+
+// Type is a monomorphic type used by the TypeChecker.
+// A VARIABLE_TYPE stands for a not yet inferred type and is bound to another
+// type through instance once it is unified.
+type Type struct {
+	Kind     TypeKind
+	Elem     *Type
+	instance *Type
+}
+
+func newTypeVariable() *Type        { return &Type{Kind: VARIABLE_TYPE} }
+func newArrayType(elem *Type) *Type { return &Type{Kind: ARRAY_TYPE, Elem: elem} }
+
+var (
+	intType    = &Type{Kind: INT_TYPE}
+	charType   = &Type{Kind: CHAR_TYPE}
+	boolType   = &Type{Kind: BOOL_TYPE}
+	stringType = &Type{Kind: STRING_TYPE}
+	voidType   = &Type{Kind: VOID_TYPE}
+)
+
+var typeNames = map[string]*Type{
+	"int":    intType,
+	"char":   charType,
+	"bool":   boolType,
+	"string": stringType,
+	"void":   voidType,
+}
+
+// annotationType converts a type annotation resolved by the Resolver.
+// An omitted annotation is inferred through a fresh type variable.
+func annotationType(a *ast.TypeAnnotation) *Type {
+	if a == nil {
+		return newTypeVariable()
+	}
+
+	if a.Elem != nil {
+		return newArrayType(annotationType(a.Elem))
+	}
+
+	if typ, ok := typeNames[a.Token.Literal]; ok {
+		return typ
+	}
+
+	return newTypeVariable()
+}
+
+func (t *Type) String() string {
+	t = prune(t)
+	switch t.Kind {
+	case VARIABLE_TYPE:
+		return "any"
+	case ARRAY_TYPE:
+		return "[" + t.Elem.String() + "]"
+	}
+
+	return string(t.Kind)
+}
+
+func (t *Type) isNumeric() bool {
+	t = prune(t)
+	return t.Kind == INT_TYPE || t.Kind == CHAR_TYPE
+}
+
+func prune(t *Type) *Type {
+	for t.Kind == VARIABLE_TYPE && t.instance != nil {
+		t = t.instance
+	}
+
+	return t
+}
+
+func occursIn(v *Type, t *Type) bool {
+	t = prune(t)
+	if t == v {
+		return true
+	}
+
+	if t.Kind == ARRAY_TYPE {
+		return occursIn(v, t.Elem)
+	}
+
+	return false
+}
+
+// unify reports whether a and b can be the same type, binding type variables
+// on the way. int and char are interchangeable because both are plain
+// integers at runtime, and a string is an array of char.
+func unify(a *Type, b *Type) bool {
+	a = prune(a)
+	b = prune(b)
+
+	if a.Kind == VARIABLE_TYPE {
+		if a == b {
+			return true
+		}
+		if occursIn(a, b) {
+			return false
+		}
+		a.instance = b
+		return true
+	}
+
+	if b.Kind == VARIABLE_TYPE {
+		return unify(b, a)
+	}
+
+	if a.isNumeric() && b.isNumeric() {
+		return true
+	}
+
+	switch {
+	case a.Kind == ARRAY_TYPE && b.Kind == ARRAY_TYPE:
+		return unify(a.Elem, b.Elem)
+	case a.Kind == ARRAY_TYPE && b.Kind == STRING_TYPE:
+		return unify(a.Elem, charType)
+	case a.Kind == STRING_TYPE && b.Kind == ARRAY_TYPE:
+		return unify(charType, b.Elem)
+	}
+
+	return a.Kind == b.Kind
+}
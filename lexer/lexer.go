@@ -65,6 +65,10 @@ func (l *Lexer) ScanToken() token.Token {
 		return l.makeToken(token.COMMA, string(char))
 	case ';':
 		return l.makeToken(token.SEMICOLON, string(char))
+	case ':':
+		return l.makeToken(token.COLON, string(char))
+	case '.':
+		return l.makeToken(token.DOT, string(char))
 
 	case '=':
 		if l.peekChar() == '=' {
@@ -274,10 +278,11 @@ func (l *Lexer) convertEscapeSequence(ch byte) (byte, error) {
 
 func (l *Lexer) makeToken(tokenType token.TokenType, literal string) token.Token {
 	return token.Token{
-		Type:    tokenType,
-		Literal: literal,
-		Line:    l.line,
-		Column:  l.column,
+		Type:     tokenType,
+		Literal:  literal,
+		Filename: l.Filename,
+		Line:     l.line,
+		Column:   l.column,
 	}
 }
 
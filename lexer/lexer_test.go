@@ -7,14 +7,15 @@ import (
 )
 
 func TestScanToken(t *testing.T) {
-	input := `(){}[],; // this is comment
+	input := `(){}[],;:. // this is comment
 +-*/%=!
 ==
 !=
 <><=>=&&||
 'a'123'\n'"abc"
-var func if else while for true false return break
+var func if else while for true false return break assert
 include hoge_fuga0
+import as export
 `
 
 	expects := []struct {
@@ -31,6 +32,8 @@ include hoge_fuga0
 		{token.RBRACKET, "]", 1, 6},
 		{token.COMMA, ",", 1, 7},
 		{token.SEMICOLON, ";", 1, 8},
+		{token.COLON, ":", 1, 9},
+		{token.DOT, ".", 1, 10},
 
 		{token.PLUS, "+", 2, 1},
 		{token.MINUS, "-", 2, 2},
@@ -65,11 +68,16 @@ include hoge_fuga0
 		{token.FALSE, "false", 7, 37},
 		{token.RETURN, "return", 7, 44},
 		{token.BREAK, "break", 7, 50},
+		{token.ASSERT, "assert", 7, 57},
 
 		{token.INCLUDE, "include", 8, 7},
 		{token.IDENT, "hoge_fuga0", 8, 18},
 
-		{token.EOF, string(byte(0)), 9, 0},
+		{token.IMPORT, "import", 9, 6},
+		{token.AS, "as", 9, 9},
+		{token.EXPORT, "export", 9, 16},
+
+		{token.EOF, string(byte(0)), 10, 0},
 	}
 
 	lexer := New("script", input)
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 
@@ -19,9 +20,21 @@ type Parser struct {
 	isFunction      bool
 	nestedLoopCount int
 	stackTop        int
+	// statementTop and loopStackTop are the stackTop at the start of the
+	// current statement and loop. They are above zero when asm blocks leave
+	// values on the stack.
+	statementTop    int
+	loopStackTop    int
+	frameSlot       int
 	scopes          []map[string]*declaredVariable
+	module          string
+	imports         map[string]string
 	Errors          []string
 	VisitedFiles    []string
+	ImportedModules []string
+	// IncludePaths are directories searched for included and imported files
+	// which are not found relative to the including file.
+	IncludePaths []string
 }
 
 type declaredVariable struct {
@@ -30,6 +43,7 @@ type declaredVariable struct {
 	scopeDepth    int
 	argumentIndex int
 	localIndex    int
+	slot          int
 }
 
 const (
@@ -40,16 +54,19 @@ const (
 type variableType string
 
 func New(lexer *lexer.Lexer) *Parser {
-	return newParser(lexer, []string{})
+	return newParser(lexer, []string{}, []string{}, "")
 }
 
-func newParser(lexer *lexer.Lexer, visitedFiles []string) *Parser {
+func newParser(lexer *lexer.Lexer, visitedFiles []string, importedModules []string, module string) *Parser {
 	p := &Parser{
-		lexer:        lexer,
-		isFunction:   false,
-		Errors:       []string{},
-		scopes:       []map[string]*declaredVariable{},
-		VisitedFiles: append(visitedFiles, lexer.Filename),
+		lexer:           lexer,
+		isFunction:      false,
+		Errors:          []string{},
+		scopes:          []map[string]*declaredVariable{},
+		module:          module,
+		imports:         map[string]string{},
+		VisitedFiles:    append(visitedFiles, canonicalPath(lexer.Filename)),
+		ImportedModules: importedModules,
 	}
 	p.nextToken()
 	p.nextToken()
@@ -59,12 +76,18 @@ func newParser(lexer *lexer.Lexer, visitedFiles []string) *Parser {
 func (p *Parser) ParseProgram() []ast.Statement {
 	statements := []ast.Statement{}
 	for p.currentToken.Type != token.EOF {
+		if p.matchToken(token.IMPORT) {
+			statements = append(statements, p.parseImport()...)
+			p.nextToken()
+			continue
+		}
+
 		if p.matchToken(token.INCLUDE) {
-			stmts := p.parseInclude()
-			if stmts != nil {
-				statements = append(statements, stmts...)
-			}
+			statements = append(statements, p.parseInclude()...)
+			p.nextToken()
+			continue
 		}
+
 		stmt := p.parseDeclaration()
 		if stmt != nil {
 			statements = append(statements, stmt)
@@ -80,11 +103,17 @@ func (p *Parser) HadErrors() bool {
 }
 
 func (p *Parser) parseDeclaration() ast.Statement {
+	top := p.stackTop
+	errors := len(p.Errors)
 	defer func() {
+		if len(p.Errors) > errors {
+			p.stackTop = top
+		}
 		if p.HadErrors() {
 			p.skipStatement()
 		}
 	}()
+	p.statementTop = top
 
 	if p.matchToken(token.VAR) {
 		return p.parseVarDeclaration()
@@ -94,9 +123,28 @@ func (p *Parser) parseDeclaration() ast.Statement {
 		return p.parseFunctionDeclaration()
 	}
 
+	if p.matchToken(token.EXPORT) {
+		return p.parseExport()
+	}
+
 	return p.parseStatement()
 }
 
+func (p *Parser) parseExport() ast.Statement {
+	if !p.matchToken(token.FUNC) {
+		p.parseError(p.currentToken, "Expect function declaration after export.")
+		return nil
+	}
+
+	function, ok := p.parseFunctionDeclaration().(ast.Function)
+	if !ok {
+		return nil
+	}
+	function.Exported = true
+
+	return function
+}
+
 func (p *Parser) parseVarDeclaration() ast.Statement {
 	if p.currentToken.Type != token.IDENT {
 		p.parseError(p.currentToken, "Expect identifier.")
@@ -106,6 +154,14 @@ func (p *Parser) parseVarDeclaration() ast.Statement {
 	local := p.declareLocalVariable(identifier)
 	p.nextToken()
 
+	var typ *ast.TypeAnnotation
+	if p.matchToken(token.COLON) {
+		typ = p.parseTypeAnnotation()
+		if typ == nil {
+			return nil
+		}
+	}
+
 	if !p.matchToken(token.ASSIGN) {
 		p.parseError(p.currentToken, "Expect '=' after identifier.")
 		return nil
@@ -126,18 +182,23 @@ func (p *Parser) parseVarDeclaration() ast.Statement {
 	isLocal := false
 	depth := 0
 	index := 0
+	slot := 0
 	if local != nil {
 		isLocal = true
 		depth = local.scopeDepth
 		index = local.localIndex
+		slot = local.slot
 	}
 
 	return ast.Var{
 		Identifier: identifier,
+		Type:       typ,
+		Module:     p.module,
 		Expression: expr,
 		IsLocal:    isLocal,
 		ScopeDepth: depth,
 		LocalIndex: index,
+		Slot:       slot,
 	}
 }
 
@@ -149,6 +210,10 @@ func (p *Parser) parseFunctionDeclaration() ast.Statement {
 
 	p.beginScope()
 	p.isFunction = true
+	enclosingFrameSlot := p.frameSlot
+	p.frameSlot = 0
+	enclosingStackTop := p.stackTop
+	p.stackTop = 0
 
 	if p.currentToken.Type != token.IDENT {
 		p.parseError(p.currentToken, "Expect function name.")
@@ -163,6 +228,7 @@ func (p *Parser) parseFunctionDeclaration() ast.Statement {
 	}
 
 	params := []token.Token{}
+	paramTypes := []*ast.TypeAnnotation{}
 	if p.currentToken.Type != token.RPAREN {
 		for {
 			if p.currentToken.Type != token.IDENT {
@@ -174,6 +240,16 @@ func (p *Parser) parseFunctionDeclaration() ast.Statement {
 			p.declareArgumentVariable(p.currentToken, len(params))
 
 			p.nextToken()
+
+			var typ *ast.TypeAnnotation
+			if p.matchToken(token.COLON) {
+				typ = p.parseTypeAnnotation()
+				if typ == nil {
+					return nil
+				}
+			}
+			paramTypes = append(paramTypes, typ)
+
 			if !p.matchToken(token.COMMA) {
 				break
 			}
@@ -185,6 +261,14 @@ func (p *Parser) parseFunctionDeclaration() ast.Statement {
 		return nil
 	}
 
+	var returnType *ast.TypeAnnotation
+	if p.matchToken(token.COLON) {
+		returnType = p.parseTypeAnnotation()
+		if returnType == nil {
+			return nil
+		}
+	}
+
 	if !p.matchToken(token.LBRACE) {
 		p.parseError(p.currentToken, "Expect '{' before function body.")
 		return nil
@@ -197,43 +281,191 @@ func (p *Parser) parseFunctionDeclaration() ast.Statement {
 
 	p.isFunction = false
 	p.endScope()
+	p.frameSlot = enclosingFrameSlot
+	p.stackTop = enclosingStackTop
+
+	return ast.Function{
+		Name:       name,
+		Module:     p.module,
+		Params:     params,
+		ParamTypes: paramTypes,
+		ReturnType: returnType,
+		Body:       body.Statements,
+	}
+}
+
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	tok := p.currentToken
+
+	if p.matchToken(token.IDENT) {
+		return &ast.TypeAnnotation{Token: tok}
+	}
+
+	if p.matchToken(token.LBRACKET) {
+		elem := p.parseTypeAnnotation()
+		if elem == nil {
+			return nil
+		}
+
+		if !p.matchToken(token.RBRACKET) {
+			p.parseError(p.currentToken, "Expect ']' after array element type.")
+			return nil
+		}
+
+		return &ast.TypeAnnotation{Token: tok, Elem: elem}
+	}
 
-	return ast.Function{Name: name, Params: params, Body: body.Statements}
+	p.parseError(p.currentToken, "Expect type.")
+	return nil
 }
 
 func (p *Parser) parseInclude() []ast.Statement {
 	if p.currentToken.Type != token.STRING {
 		p.parseError(p.currentToken, "Expect include name.")
+		p.skipStatement()
 		return nil
 	}
+	name := p.currentToken
+	p.nextToken()
 
-	if slices.Contains(p.VisitedFiles, p.currentToken.Literal) {
+	if p.currentToken.Type != token.SEMICOLON {
+		p.parseError(p.currentToken, "Expect ';' after statement.")
+		p.skipStatement()
 		return nil
 	}
 
-	var code string
-	if lib, ok := lib.LookupBuilinLibrary(p.currentToken.Literal); ok {
-		code = lib
-	} else {
-		bytes, err := os.ReadFile(p.currentToken.Literal)
-		if err != nil {
-			p.parseError(p.currentToken, fmt.Sprintf("Including file can not read. (%s)", p.currentToken.Literal))
-			return nil
-		}
-		code = string(bytes)
+	filename, code, ok := p.readSource(name.Literal)
+	if !ok {
+		p.parseError(name, fmt.Sprintf("Including file can not read. (%s)", name.Literal))
+		return nil
+	}
+
+	if slices.Contains(p.VisitedFiles, canonicalPath(filename)) {
+		return nil
 	}
 
-	lexer := lexer.New(p.currentToken.Literal, code)
-	parser := newParser(lexer, p.VisitedFiles)
+	lexer := lexer.New(filename, code)
+	parser := newParser(lexer, p.VisitedFiles, p.ImportedModules, p.module)
+	parser.IncludePaths = p.IncludePaths
 	statements := parser.ParseProgram()
 	if parser.HadErrors() {
 		p.Errors = append(p.Errors, parser.Errors...)
 	}
 	p.VisitedFiles = parser.VisitedFiles
+	p.ImportedModules = parser.ImportedModules
+
+	return statements
+}
+
+// parseImport parses `import "name" as alias;`. The module is parsed with its
+// own namespace and included files, and is emitted only once however many
+// times it is imported.
+func (p *Parser) parseImport() []ast.Statement {
+	if p.currentToken.Type != token.STRING {
+		p.parseError(p.currentToken, "Expect import name.")
+		p.skipStatement()
+		return nil
+	}
+	name := p.currentToken
+	p.nextToken()
+
+	if !p.matchToken(token.AS) {
+		p.parseError(p.currentToken, "Expect 'as' after import name.")
+		p.skipStatement()
+		return nil
+	}
+
+	if p.currentToken.Type != token.IDENT {
+		p.parseError(p.currentToken, "Expect module alias.")
+		p.skipStatement()
+		return nil
+	}
+	alias := p.currentToken
+	p.nextToken()
+
+	if p.currentToken.Type != token.SEMICOLON {
+		p.parseError(p.currentToken, "Expect ';' after statement.")
+		p.skipStatement()
+		return nil
+	}
+
+	if _, ok := p.imports[alias.Literal]; ok {
+		p.parseError(alias, "Already imported module with this alias.")
+		return nil
+	}
+
+	filename, code, ok := p.readSource(name.Literal)
+	if !ok {
+		p.parseError(name, fmt.Sprintf("Importing file can not read. (%s)", name.Literal))
+		return nil
+	}
+
+	module := canonicalPath(filename)
+	p.imports[alias.Literal] = module
+	if slices.Contains(p.ImportedModules, module) {
+		return nil
+	}
+	p.ImportedModules = append(p.ImportedModules, module)
+
+	lexer := lexer.New(filename, code)
+	parser := newParser(lexer, []string{}, p.ImportedModules, module)
+	parser.IncludePaths = p.IncludePaths
+	statements := parser.ParseProgram()
+	if parser.HadErrors() {
+		p.Errors = append(p.Errors, parser.Errors...)
+	}
+	p.ImportedModules = parser.ImportedModules
 
 	return statements
 }
 
+// readSource returns the filename and the code of an included or imported
+// file. Build-in libraries are looked up first, then relative paths are
+// resolved against the directory of the including file and the include paths
+// in order.
+func (p *Parser) readSource(name string) (string, string, bool) {
+	if lib, ok := lib.LookupBuilinLibrary(name); ok {
+		return name, lib, true
+	}
+
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = []string{filepath.Join(filepath.Dir(p.lexer.Filename), name)}
+		for _, dir := range p.IncludePaths {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	for _, path := range candidates {
+		bytes, err := os.ReadFile(path)
+		if err == nil {
+			return path, string(bytes), true
+		}
+	}
+
+	return "", "", false
+}
+
+// canonicalPath returns the absolute path without symbolic links to detect
+// the same file included through different paths.
+// Build-in libraries are identified by their names.
+func canonicalPath(filename string) string {
+	if _, ok := lib.LookupBuilinLibrary(filename); ok {
+		return filename
+	}
+
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.Clean(filename)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	return path
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	if p.matchToken(token.IF) {
 		return p.parseIf()
@@ -259,6 +491,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseBreak()
 	}
 
+	if p.currentToken.Type == token.ASSERT {
+		return p.parseAssert()
+	}
+
+	if p.currentToken.Type == token.ASM {
+		return p.parseAsmStatement()
+	}
+
 	expr := p.parseExpression()
 	if expr == nil {
 		return nil
@@ -278,19 +518,29 @@ func (p *Parser) parseReturn() ast.Statement {
 		return nil
 	}
 
+	tok := p.currentToken
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
-		return ast.Return{Value: nil}
+		if p.stackTop != 0 {
+			p.parseError(tok, "Can not return with asm values on the stack.")
+			return nil
+		}
+		return ast.Return{Token: tok, Value: nil}
 	}
 
 	p.nextToken()
+	errors := len(p.Errors)
 	expr := p.parseExpression()
 	if p.currentToken.Type != token.SEMICOLON {
 		p.parseError(p.currentToken, "Expect ';' after statement.")
 		return nil
 	}
+	if len(p.Errors) == errors && p.stackTop != 0 {
+		p.parseError(tok, "Can not return with asm values on the stack.")
+		return nil
+	}
 
-	return ast.Return{Value: expr}
+	return ast.Return{Token: tok, Value: expr}
 }
 
 func (p *Parser) parseBreak() ast.Statement {
@@ -300,6 +550,11 @@ func (p *Parser) parseBreak() ast.Statement {
 	}
 
 	tok := p.currentToken
+	if p.stackTop != p.loopStackTop {
+		p.parseError(tok, "Can not break with asm values on the stack.")
+		return nil
+	}
+
 	if p.peekToken.Type != token.SEMICOLON {
 		p.parseError(p.currentToken, "Expect ';' after statement.")
 		return nil
@@ -309,6 +564,42 @@ func (p *Parser) parseBreak() ast.Statement {
 	return ast.Break{Token: tok}
 }
 
+func (p *Parser) parseAssert() ast.Statement {
+	tok := p.currentToken
+	p.nextToken()
+
+	if p.currentToken.Type != token.LPAREN {
+		p.parseError(p.currentToken, "Expect '(' after assert.")
+		return nil
+	}
+	p.nextToken()
+
+	condition := p.parseExpression()
+
+	message := ""
+	if p.matchToken(token.COMMA) {
+		if p.currentToken.Type != token.STRING {
+			p.parseError(p.currentToken, "Expect assertion message.")
+			return nil
+		}
+		message = p.currentToken.Literal
+		p.nextToken()
+	}
+
+	if p.currentToken.Type != token.RPAREN {
+		p.parseError(p.currentToken, "Expect ')' after assert arguments.")
+		return nil
+	}
+	p.nextToken()
+
+	if p.currentToken.Type != token.SEMICOLON {
+		p.parseError(p.currentToken, "Expect ';' after statement.")
+		return nil
+	}
+
+	return ast.Assert{Token: tok, Condition: condition, Message: message}
+}
+
 func (p *Parser) parseIf() ast.Statement {
 	if p.currentToken.Type != token.LPAREN {
 		p.parseError(p.currentToken, "Expect '(' after if.")
@@ -324,12 +615,12 @@ func (p *Parser) parseIf() ast.Statement {
 	}
 	p.nextToken()
 
-	thenStmt := p.parseDeclaration()
+	thenStmt := p.parseBody()
 	var elseStmt ast.Statement
 	if p.peekToken.Type == token.ELSE {
 		p.nextToken()
 		p.nextToken()
-		elseStmt = p.parseDeclaration()
+		elseStmt = p.parseBody()
 	}
 
 	return ast.If{Condition: condition, Then: thenStmt, Else: elseStmt}
@@ -337,6 +628,8 @@ func (p *Parser) parseIf() ast.Statement {
 
 func (p *Parser) parseWhile() ast.Statement {
 	p.beginLoop()
+	enclosingLoopStackTop := p.loopStackTop
+	p.loopStackTop = p.stackTop
 
 	if p.currentToken.Type != token.LPAREN {
 		p.parseError(p.currentToken, "Expect '(' after while.")
@@ -352,15 +645,18 @@ func (p *Parser) parseWhile() ast.Statement {
 	}
 	p.nextToken()
 
-	body := p.parseDeclaration()
+	body := p.parseBody()
+	p.balanceLoopStack()
 
 	p.endLoop()
+	p.loopStackTop = enclosingLoopStackTop
 	return ast.While{Condition: condition, Body: body}
 }
 
 func (p *Parser) parseFor() ast.Statement {
 	p.beginScope()
 	p.beginLoop()
+	enclosingLoopStackTop := p.loopStackTop
 
 	if p.currentToken.Type != token.LPAREN {
 		p.parseError(p.currentToken, "Expect '(' after while.")
@@ -382,6 +678,7 @@ func (p *Parser) parseFor() ast.Statement {
 		initializer = ast.ExpressionStatement{Expression: expr}
 	}
 	p.nextToken()
+	p.loopStackTop = p.stackTop
 
 	var condition ast.Expression
 	if p.currentToken.Type != token.SEMICOLON {
@@ -404,9 +701,11 @@ func (p *Parser) parseFor() ast.Statement {
 	}
 	p.nextToken()
 
-	body := p.parseDeclaration()
+	body := p.parseBody()
+	p.balanceLoopStack()
 
 	p.endLoop()
+	p.loopStackTop = enclosingLoopStackTop
 
 	if iter != nil {
 		body = ast.Block{
@@ -439,6 +738,7 @@ func (p *Parser) parseFor() ast.Statement {
 
 func (p *Parser) parseBlock() ast.Statement {
 	p.beginScope()
+	top := p.stackTop
 	stmts := []ast.Statement{}
 	for p.currentToken.Type != token.RBRACE {
 		if p.currentToken.Type == token.EOF {
@@ -448,11 +748,186 @@ func (p *Parser) parseBlock() ast.Statement {
 		stmts = append(stmts, p.parseDeclaration())
 		p.nextToken()
 	}
+	p.balanceStack(top)
 
 	p.endScope()
 	return ast.Block{Statements: stmts}
 }
 
+// parseBody parses the body of an if, while or for statement.
+func (p *Parser) parseBody() ast.Statement {
+	top := p.stackTop
+	body := p.parseDeclaration()
+	p.balanceStack(top)
+
+	return body
+}
+
+// balanceStack reports the values left on the stack by the asm blocks of a
+// block or a body, which would be left only on some paths of the program.
+func (p *Parser) balanceStack(top int) {
+	if p.stackTop != top {
+		p.parseError(p.currentToken, "Can not leave asm values on the stack at end of block.")
+		p.stackTop = top
+	}
+}
+
+// balanceLoopStack reports the values taken by asm blocks in the condition or
+// the iterator of a loop, which are evaluated on every iteration.
+func (p *Parser) balanceLoopStack() {
+	if p.stackTop != p.loopStackTop {
+		p.parseError(p.currentToken, "Can not take asm values in loop condition.")
+		p.stackTop = p.loopStackTop
+	}
+}
+
+// parseAsmStatement parses an asm block used as a statement, which changes
+// the stack by its declared stack effect.
+func (p *Parser) parseAsmStatement() ast.Statement {
+	asm, ok := p.parseAsm()
+	if !ok {
+		return nil
+	}
+
+	p.discardStack(asm.In)
+	for i := 0; i < asm.Out; i++ {
+		p.pushStack()
+	}
+
+	return ast.AsmStatement{Asm: asm}
+}
+
+// parseAsmExpression parses an asm block used as an expression, which takes
+// its inputs from the values left by asm statements and pushes one value.
+func (p *Parser) parseAsmExpression() ast.Expression {
+	tok := p.currentToken
+	asm, ok := p.parseAsm()
+	if !ok {
+		return nil
+	}
+
+	if asm.Out != 1 {
+		p.parseError(tok, "Expect 'out: 1' for asm expression.")
+		return nil
+	}
+	if asm.In > 0 && p.stackTop != p.statementTop {
+		p.parseError(tok, "Expect asm inputs on the top of the stack.")
+		return nil
+	}
+
+	p.discardStack(asm.In)
+	p.pushStack()
+	return asm
+}
+
+// parseAsm parses `asm(in: 2, out: 1) { add; }`. The stack effect may be
+// omitted, and defaults to zero.
+func (p *Parser) parseAsm() (ast.Asm, bool) {
+	asm := ast.Asm{Token: p.currentToken, Module: p.module}
+	p.nextToken()
+
+	if p.matchToken(token.LPAREN) {
+		for {
+			name := p.currentToken
+			if name.Type != token.IDENT || (name.Literal != "in" && name.Literal != "out") {
+				p.parseError(name, "Expect 'in' or 'out'.")
+				return asm, false
+			}
+			p.nextToken()
+
+			if !p.matchToken(token.COLON) {
+				p.parseError(p.currentToken, "Expect ':' after stack effect name.")
+				return asm, false
+			}
+
+			if p.currentToken.Type != token.INT {
+				p.parseError(p.currentToken, "Expect number of values.")
+				return asm, false
+			}
+			count, _ := strconv.Atoi(p.currentToken.Literal)
+			if name.Literal == "in" {
+				asm.In = count
+			} else {
+				asm.Out = count
+			}
+			p.nextToken()
+
+			if !p.matchToken(token.COMMA) {
+				break
+			}
+		}
+
+		if !p.matchToken(token.RPAREN) {
+			p.parseError(p.currentToken, "Expect ')' after stack effect.")
+			return asm, false
+		}
+	}
+
+	if !p.matchToken(token.LBRACE) {
+		p.parseError(p.currentToken, "Expect '{' before asm instructions.")
+		return asm, false
+	}
+
+	for p.currentToken.Type != token.RBRACE {
+		instruction, ok := p.parseAsmInstruction()
+		if !ok {
+			for p.currentToken.Type != token.RBRACE && p.currentToken.Type != token.EOF {
+				p.nextToken()
+			}
+			return asm, false
+		}
+		asm.Instructions = append(asm.Instructions, instruction)
+	}
+
+	if asm.In > p.stackTop {
+		p.parseError(asm.Token, "Not enough values on the stack for asm.")
+		return asm, false
+	}
+
+	return asm, true
+}
+
+// parseAsmInstruction parses a mnemonic followed by an optional number, label
+// name or function name.
+func (p *Parser) parseAsmInstruction() (ast.AsmInstruction, bool) {
+	instruction := ast.AsmInstruction{Mnemonic: p.currentToken}
+	if p.currentToken.Type != token.IDENT {
+		if p.currentToken.Type == token.EOF {
+			p.parseError(p.currentToken, "Expect '}' after asm instructions.")
+		} else {
+			p.parseError(p.currentToken, "Expect asm instruction.")
+		}
+		return instruction, false
+	}
+	p.nextToken()
+
+	switch p.currentToken.Type {
+	case token.IDENT:
+		instruction.Operand = p.currentToken
+		p.nextToken()
+	case token.INT, token.MINUS:
+		negative := p.matchToken(token.MINUS)
+		if p.currentToken.Type != token.INT {
+			p.parseError(p.currentToken, "Expect number after '-'.")
+			return instruction, false
+		}
+		instruction.Operand = p.currentToken
+		instruction.Value, _ = strconv.ParseInt(p.currentToken.Literal, 0, 64)
+		if negative {
+			instruction.Operand.Literal = "-" + instruction.Operand.Literal
+			instruction.Value = -instruction.Value
+		}
+		p.nextToken()
+	}
+
+	if !p.matchToken(token.SEMICOLON) {
+		p.parseError(p.currentToken, "Expect ';' after asm instruction.")
+		return instruction, false
+	}
+
+	return instruction, true
+}
+
 func (p *Parser) parseExpression() ast.Expression {
 	expr := p.parseAssign()
 	p.popStack()
@@ -595,6 +1070,7 @@ func (p *Parser) parseIndex() ast.Expression {
 	expr := p.parseCall()
 	if p.matchPeekToken(token.LBRACKET) {
 		p.nextToken()
+		tok := p.currentToken
 		p.nextToken()
 
 		index := p.parseExpression()
@@ -604,7 +1080,7 @@ func (p *Parser) parseIndex() ast.Expression {
 			return nil
 		}
 
-		expr = ast.Index{Receiver: expr, Index: index}
+		expr = ast.Index{Token: tok, Receiver: expr, Index: index}
 	}
 
 	return expr
@@ -612,35 +1088,58 @@ func (p *Parser) parseIndex() ast.Expression {
 
 func (p *Parser) parseCall() ast.Expression {
 	if p.currentToken.Type == token.IDENT &&
-		p.peekToken.Type == token.LPAREN {
-		callee := p.currentToken
+		p.peekToken.Type == token.DOT {
+		namespace := p.currentToken
+		module, ok := p.imports[namespace.Literal]
+		if !ok {
+			p.parseError(namespace, "Module is not imported.")
+			return nil
+		}
 		p.nextToken()
 		p.nextToken()
 
-		arguments := []ast.Expression{}
-		if p.currentToken.Type != token.RPAREN {
-			for {
-				arguments = append(arguments, p.parseExpression())
-				p.pushStack()
-
-				if !p.matchToken(token.COMMA) {
-					break
-				}
-			}
-		}
-
-		if p.currentToken.Type != token.RPAREN {
-			p.parseError(p.currentToken, "Expect ')' after arguments.")
+		if p.currentToken.Type != token.IDENT ||
+			p.peekToken.Type != token.LPAREN {
+			p.parseError(p.currentToken, "Expect function call after module name.")
 			return nil
 		}
-		p.discardStack(len(arguments))
-		p.pushStack()
-		return ast.Call{Callee: callee, Arguments: arguments}
+
+		return p.parseArguments(p.currentToken, namespace, module)
+	}
+
+	if p.currentToken.Type == token.IDENT &&
+		p.peekToken.Type == token.LPAREN {
+		return p.parseArguments(p.currentToken, token.Token{}, p.module)
 	}
 
 	return p.parsePrimary()
 }
 
+func (p *Parser) parseArguments(callee token.Token, namespace token.Token, module string) ast.Expression {
+	p.nextToken()
+	p.nextToken()
+
+	arguments := []ast.Expression{}
+	if p.currentToken.Type != token.RPAREN {
+		for {
+			arguments = append(arguments, p.parseExpression())
+			p.pushStack()
+
+			if !p.matchToken(token.COMMA) {
+				break
+			}
+		}
+	}
+
+	if p.currentToken.Type != token.RPAREN {
+		p.parseError(p.currentToken, "Expect ')' after arguments.")
+		return nil
+	}
+	p.discardStack(len(arguments))
+	p.pushStack()
+	return ast.Call{Callee: callee, Namespace: namespace, Module: module, Arguments: arguments}
+}
+
 func (p *Parser) parsePrimary() ast.Expression {
 	switch p.currentToken.Type {
 	case token.INT:
@@ -658,10 +1157,14 @@ func (p *Parser) parsePrimary() ast.Expression {
 		return ast.BooleanLiteral{Token: p.currentToken, Value: p.currentToken.Type == token.TRUE}
 	}
 
-	if p.matchToken(token.LBRACKET) {
+	if p.currentToken.Type == token.LBRACKET {
 		return p.parseArrayLiteral()
 	}
 
+	if p.currentToken.Type == token.ASM {
+		return p.parseAsmExpression()
+	}
+
 	if p.matchToken(token.LPAREN) {
 		expr := p.parseExpression()
 		if p.currentToken.Type != token.RPAREN {
@@ -694,19 +1197,24 @@ func (p *Parser) parseVariable() ast.Expression {
 		}
 		return ast.Variable{
 			Identifier:    p.currentToken,
+			Module:        p.module,
 			Type:          typ,
 			ScopeDepth:    local.scopeDepth,
 			LocalIndex:    local.localIndex,
+			Slot:          local.slot,
 			ArgumentIndex: local.argumentIndex,
 			RelativeIndex: top,
 		}
 	}
 	p.pushStack()
 
-	return ast.Variable{Identifier: p.currentToken}
+	return ast.Variable{Identifier: p.currentToken, Module: p.module}
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
+	tok := p.currentToken
+	p.nextToken()
+
 	elements := []ast.Expression{}
 	if p.currentToken.Type != token.RPAREN {
 		for {
@@ -724,7 +1232,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	}
 
 	p.pushStack()
-	return ast.ArrayLiteral{Elements: elements}
+	return ast.ArrayLiteral{Token: tok, Elements: elements}
 }
 
 func (p *Parser) nextToken() {
@@ -783,13 +1291,25 @@ func (p *Parser) beginScope() {
 	p.scopes = append(p.scopes, map[string]*declaredVariable{})
 }
 
+// endScope releases the frame slots of the local variables in the scope so
+// that sibling scopes reuse them.
 func (p *Parser) endScope() {
+	for _, variable := range p.scopes[len(p.scopes)-1] {
+		if variable.typ == LOCAL {
+			p.frameSlot--
+		}
+	}
 	p.scopes = p.scopes[:len(p.scopes)-1]
 }
 
 func (p *Parser) declareLocalVariable(name token.Token) *declaredVariable {
 	depth := len(p.scopes)
-	return p.declareVariable(name, &declaredVariable{typ: LOCAL, scopeDepth: depth})
+	variable := p.declareVariable(name, &declaredVariable{typ: LOCAL, scopeDepth: depth, slot: p.frameSlot})
+	if variable != nil {
+		p.frameSlot++
+	}
+
+	return variable
 }
 
 func (p *Parser) declareArgumentVariable(name token.Token, argumentIndex int) {
@@ -860,7 +1380,7 @@ func (p *Parser) skipStatement() {
 		}
 
 		switch p.peekToken.Type {
-		case token.VAR, token.FUNC, token.RETURN, token.BREAK, token.IF, token.WHILE:
+		case token.VAR, token.FUNC, token.RETURN, token.BREAK, token.IF, token.WHILE, token.ASSERT, token.ASM:
 			return
 		}
 		p.nextToken()
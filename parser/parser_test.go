@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/simomu-github/sfflt_lang/ast"
@@ -244,6 +245,35 @@ func TestParseLocalVariable(t *testing.T) {
 	}
 }
 
+func TestParseLocalVariableSlot(t *testing.T) {
+	input := "{ var a = 0; { var b = 1; } { var c = 2; var d = 3; } }"
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	stmt := parser.ParseProgram()
+
+	block := stmt[0].(ast.Block)
+	a := block.Statements[0].(ast.Var)
+	b := block.Statements[1].(ast.Block).Statements[0].(ast.Var)
+	c := block.Statements[2].(ast.Block).Statements[0].(ast.Var)
+	d := block.Statements[2].(ast.Block).Statements[1].(ast.Var)
+
+	expects := []struct {
+		variable ast.Var
+		slot     int
+	}{
+		{a, 0},
+		{b, 1},
+		{c, 1},
+		{d, 2},
+	}
+
+	for i, expect := range expects {
+		if expect.variable.Slot != expect.slot {
+			t.Fatalf("tests[%d] - slot wrong. expected=%d, got=%d", i, expect.slot, expect.variable.Slot)
+		}
+	}
+}
+
 func TestCall(t *testing.T) {
 	input := "test(1, 2)"
 	lexer := lexer.New("script", input)
@@ -775,6 +805,56 @@ func TestParseBreak(t *testing.T) {
 	}
 }
 
+func TestParseAssert(t *testing.T) {
+	input := `assert(1, "message"); assert(2);`
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	stmts := parser.ParseProgram()
+
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	a, ok := stmts[0].(ast.Assert)
+	if !ok {
+		t.Fatalf("Statement is not Assert")
+	}
+
+	if a.Token.Type != token.ASSERT {
+		t.Fatalf("Assert token is not match")
+	}
+
+	if a.Token.Filename != "script" {
+		t.Fatalf("Assert filename is not match")
+	}
+
+	intLiteral, ok := a.Condition.(ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("Condition is not IntegerLiteral")
+	}
+
+	if intLiteral.Value != 1 {
+		t.Fatalf("IntegerLiteral value is not match")
+	}
+
+	if a.Message != "message" {
+		t.Fatalf("Message is not match")
+	}
+
+	a, ok = stmts[1].(ast.Assert)
+	if !ok {
+		t.Fatalf("Statement is not Assert")
+	}
+
+	if a.Message != "" {
+		t.Fatalf("Message is not empty")
+	}
+
+	if parser.stackTop != 0 {
+		t.Fatalf("Parser's stack top does not match")
+	}
+}
+
 func TestParseAssign(t *testing.T) {
 	input := "a = b = 2"
 	lexer := lexer.New("script", input)
@@ -922,6 +1002,47 @@ func TestParseFunction(t *testing.T) {
 	}
 }
 
+func TestParseTypeAnnotation(t *testing.T) {
+	input := "var a: [[int]] = 1; func f(b: char, c): bool { }"
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	stmts := parser.ParseProgram()
+
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	varStmt, ok := stmts[0].(ast.Var)
+	if !ok {
+		t.Fatalf("Statement is not Var")
+	}
+
+	if varStmt.Type.String() != "[[int]]" {
+		t.Fatalf("Variable type is not match. got=%s", varStmt.Type)
+	}
+
+	funcStmt, ok := stmts[1].(ast.Function)
+	if !ok {
+		t.Fatalf("Statement is not Function")
+	}
+
+	if len(funcStmt.ParamTypes) != 2 {
+		t.Fatalf("Parameter types length is not match")
+	}
+
+	if funcStmt.ParamTypes[0].String() != "char" {
+		t.Fatalf("Parameter type is not match. got=%s", funcStmt.ParamTypes[0])
+	}
+
+	if funcStmt.ParamTypes[1] != nil {
+		t.Fatalf("Parameter type is not omitted")
+	}
+
+	if funcStmt.ReturnType.String() != "bool" {
+		t.Fatalf("Return type is not match. got=%s", funcStmt.ReturnType)
+	}
+}
+
 func TestParseFunctionWithCall(t *testing.T) {
 	input := "func test1(a, b) { test2(a, b); }"
 	lexer := lexer.New("script", input)
@@ -1267,3 +1388,202 @@ func TestParseInclude(t *testing.T) {
 		t.Fatalf("Value does not match")
 	}
 }
+
+func TestParseImport(t *testing.T) {
+	input := `import "../fixtures/module.sflt" as m; m.f(1);`
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	stmts := parser.ParseProgram()
+
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	if len(stmts) != 3 {
+		t.Fatalf("Statements length is not match. got=%d", len(stmts))
+	}
+
+	f, ok := stmts[0].(ast.Function)
+	if !ok {
+		t.Fatalf("Statement is not Function")
+	}
+
+	module, _ := filepath.Abs("../fixtures/module.sflt")
+	if f.Module != module || !f.Exported {
+		t.Fatalf("Exported function is not match")
+	}
+
+	g, ok := stmts[1].(ast.Function)
+	if !ok {
+		t.Fatalf("Statement is not Function")
+	}
+
+	if g.Exported {
+		t.Fatalf("Function is exported")
+	}
+
+	inner := f.Body[0].(ast.Return).Value.(ast.Call)
+	if inner.IsQualified() || inner.Module != module {
+		t.Fatalf("Call in module is not match")
+	}
+
+	stmt := stmts[2].(ast.ExpressionStatement)
+	c, ok := stmt.Expression.(ast.Call)
+	if !ok {
+		t.Fatalf("Expression is not Call")
+	}
+
+	if c.Namespace.Literal != "m" || c.Module != module || c.Callee.Literal != "f" {
+		t.Fatalf("Qualified call is not match")
+	}
+}
+
+func TestParseIncludeRelativeToIncludingFile(t *testing.T) {
+	input := `include "../fixtures/nested/include.sflt"; include "../fixtures/./include.sflt";`
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	stmts := parser.ParseProgram()
+
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	// nested/include.sflt includes ../include.sflt, which is not included twice.
+	if len(stmts) != 2 {
+		t.Fatalf("Statements length is not match. got=%d", len(stmts))
+	}
+
+	for i, expect := range []int64{1, 2} {
+		stmt := stmts[i].(ast.ExpressionStatement)
+		intLiteral, ok := stmt.Expression.(ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("Not IntegerLiteral")
+		}
+
+		if intLiteral.Value != expect {
+			t.Fatalf("Value does not match")
+		}
+	}
+}
+
+func TestParseIncludeWithIncludePaths(t *testing.T) {
+	input := `include "include.sflt";`
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	parser.IncludePaths = []string{"../fixtures"}
+	stmts := parser.ParseProgram()
+
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	if len(stmts) != 1 {
+		t.Fatalf("Statements length is not match. got=%d", len(stmts))
+	}
+}
+
+func TestParseAsm(t *testing.T) {
+	input := `
+func f(a) {
+  asm(out: 1) { push -1; }
+  putn(a);
+  putn(asm(in: 1, out: 1) { copy 0; add; });
+  asm { label loop; jz loop; }
+}
+`
+	lexer := lexer.New("script", input)
+	parser := New(lexer)
+	stmts := parser.ParseProgram()
+	if parser.HadErrors() {
+		t.Fatalf("Parse error occurred. %v", parser.Errors)
+	}
+
+	body := stmts[0].(ast.Function).Body
+	asmStmt, ok := body[0].(ast.AsmStatement)
+	if !ok {
+		t.Fatalf("Not AsmStatement")
+	}
+	if asmStmt.Asm.In != 0 || asmStmt.Asm.Out != 1 {
+		t.Fatalf("Stack effect is not match. in=%d, out=%d", asmStmt.Asm.In, asmStmt.Asm.Out)
+	}
+	push := asmStmt.Asm.Instructions[0]
+	if push.Mnemonic.Literal != "push" || push.Operand.Literal != "-1" || push.Value != -1 {
+		t.Fatalf("Instruction is not match. got=%+v", push)
+	}
+
+	// The value left by the asm statement is below the argument.
+	call := body[1].(ast.ExpressionStatement).Expression.(ast.Call)
+	if variable := call.Arguments[0].(ast.Variable); variable.RelativeIndex != 1 {
+		t.Fatalf("Argument's relative index is not match. got=%d", variable.RelativeIndex)
+	}
+
+	call = body[2].(ast.ExpressionStatement).Expression.(ast.Call)
+	asm, ok := call.Arguments[0].(ast.Asm)
+	if !ok {
+		t.Fatalf("Not Asm")
+	}
+	if asm.In != 1 || asm.Out != 1 || len(asm.Instructions) != 2 {
+		t.Fatalf("Asm is not match. got=%+v", asm)
+	}
+
+	labels := body[3].(ast.AsmStatement).Asm.Instructions
+	if labels[1].Mnemonic.Literal != "jz" || labels[1].Operand.Type != token.IDENT {
+		t.Fatalf("Instruction is not match. got=%+v", labels[1])
+	}
+
+	if parser.stackTop != 0 {
+		t.Fatalf("Parser's stack top does not match")
+	}
+}
+
+func TestParseAsmStackErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{
+			"func f() { asm(out: 1) { push 1; } return 0; }",
+			"script:1 Error at 'return': Can not return with asm values on the stack.\n",
+		},
+		{
+			"while (true) { asm(out: 1) { push 1; } break; }",
+			"script:1 Error at 'break': Can not break with asm values on the stack.\n",
+		},
+		{
+			"if (true) asm(out: 1) { push 1; }",
+			"script:1 Error at '}': Can not leave asm values on the stack at end of block.\n",
+		},
+		{
+			"asm(out: 1) { push 1; } while (asm(in: 1, out: 1) { dup; }) { }",
+			"script:1 Error at '}': Can not take asm values in loop condition.\n",
+		},
+		{
+			"asm(in: 1) { discard; }",
+			"script:1 Error at 'asm': Not enough values on the stack for asm.\n",
+		},
+		{
+			"putn(asm { push 1; });",
+			"script:1 Error at 'asm': Expect 'out: 1' for asm expression.\n",
+		},
+		{
+			"asm(out: 1) { push 1; } var x = asm(in: 1, out: 1) { dup; };",
+			"script:1 Error at 'asm': Expect asm inputs on the top of the stack.\n",
+		},
+		{
+			"asm { push 1 }",
+			"script:1 Error at '}': Expect ';' after asm instruction.\n",
+		},
+	}
+
+	for i, tt := range tests {
+		lexer := lexer.New("script", tt.input)
+		parser := New(lexer)
+		parser.ParseProgram()
+		if len(parser.Errors) == 0 {
+			t.Fatalf("tests[%d] - Parse error does not occur.", i)
+		}
+		if parser.Errors[0] != tt.expect {
+			t.Fatalf("tests[%d] - error wrong. expected=%q, got=%q", i, tt.expect, parser.Errors[0])
+		}
+	}
+}
@@ -11,6 +11,11 @@ declare -A EXAMPLES=(
 	['local_var_and_logiral_operation']='11'
 	['recursion_local_variable']='321'
 	['stable_sort']='[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]'
+	['import']='[1, 2, 3]'
+	['garbage_collection']='5050'
+	['tail_call']='50000500000'
+	['inline_asm']='731'
+	['global_before_var']='05'
 )
 
 has_failure=false
@@ -31,6 +36,18 @@ for example in "${!EXAMPLES[@]}"; do
 	fi
 done
 
+for path in $SCRIPT_DIR/*.sflt; do
+	file=$(basename $path .sflt)
+
+	echo "Typecheck ${file}"
+	if go run $SCRIPT_DIR/../cmd/sfflt_lang.go -typecheck -output $SCRIPT_DIR/test.fflt $path; then
+		echo "File: ${file} OK"
+	else
+		echo "File: ${file} type error"
+		has_failure=true
+	fi
+done
+
 if [ "$has_failure" = true ]; then
 	exit 1
 fi
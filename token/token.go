@@ -30,6 +30,8 @@ const (
 
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -48,17 +50,23 @@ const (
 	FOR    = "FOR"
 	RETURN = "RETURN"
 	BREAK  = "BREAK"
+	ASSERT = "ASSERT"
+	ASM    = "ASM"
 
 	INCLUDE = "INCLUDE"
+	IMPORT  = "IMPORT"
+	AS      = "AS"
+	EXPORT  = "EXPORT"
 )
 
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type     TokenType
+	Literal  string
+	Filename string
+	Line     int
+	Column   int
 }
 
 var keywords = map[string]TokenType{
@@ -72,8 +80,13 @@ var keywords = map[string]TokenType{
 	"for":    FOR,
 	"return": RETURN,
 	"break":  BREAK,
+	"assert": ASSERT,
+	"asm":    ASM,
 
 	"include": INCLUDE,
+	"import":  IMPORT,
+	"as":      AS,
+	"export":  EXPORT,
 }
 
 func LookupIdent(ident string) TokenType {